@@ -0,0 +1,253 @@
+package taskstats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// Constants describing struct acct_v3 from acct(5).
+const (
+	sizeofAcctV3 = 64
+
+	// acctV3 is the version of struct acct_v3, which is combined with
+	// acctByteOrder when records are written in big endian byte order.
+	acctV3        = 3
+	acctByteOrder = 0x80
+
+	// acctHZ is the rate of the clock ticks used by acct_v3 times.
+	acctHZ = 100
+
+	// acctCommLen is the size of the command name, including its NUL
+	// terminator.
+	acctCommLen = 16
+)
+
+// An AcctWriter writes process statistics as BSD process accounting records
+// in the acct_v3 format described by acct(5), as written by the kernel when
+// process accounting is enabled using acct(2). The records can be read by
+// tools such as lastcomm(1) and sa(8).
+//
+// Records are written in native byte order, which those tools expect. Each
+// record is written using a single call to Write, so a file opened with
+// os.O_APPEND may be shared with other writers.
+//
+// The kernel does not report a controlling terminal in taskstats, so the
+// terminal of each record is zero. The memory usage of each record is the
+// peak virtual memory size of the process, in kilobytes.
+type AcctWriter struct {
+	w     io.Writer
+	b     [sizeofAcctV3]byte
+	exits exitSet
+}
+
+// NewAcctWriter creates an AcctWriter which writes records to w.
+func NewAcctWriter(w io.Writer) *AcctWriter {
+	return &AcctWriter{w: w}
+}
+
+// WriteExit writes a record for the process whose exit is described by e.
+// Like the kernel, only one record is written per process, so exits of
+// threads whose process is still running only contribute their usage to the
+// record of their process. Every exit should be written for the records of
+// multithreaded processes to be complete.
+//
+// As described for Exit, on kernels which do not report TGIDs a thread group
+// leader which exits before its threads is written both alone and with its
+// process.
+func (w *AcctWriter) WriteExit(e Exit) error {
+	tgid, _, ok := w.exits.add(e)
+	if !ok {
+		return nil
+	}
+
+	stats := w.exits.final[tgid]
+	w.exits.remove(tgid)
+
+	return w.WriteStats(stats)
+}
+
+// WriteStats writes a record for the final statistics s of a process.
+func (w *AcctWriter) WriteStats(s *Stats) error {
+	putAcctV3(w.b[:], s)
+	_, err := w.w.Write(w.b[:])
+	return err
+}
+
+// putAcctV3 encodes s as a struct acct_v3 in native byte order into b.
+func putAcctV3(b []byte, s *Stats) {
+	_ = b[sizeofAcctV3-1]
+	clear(b)
+
+	order := binary.NativeEndian
+
+	version := byte(acctV3)
+	if order.Uint16([]byte{0x00, 0x01}) == 0x0001 {
+		version |= acctByteOrder
+	}
+
+	var btime uint32
+	if u := s.BeginTime.Unix(); u > 0 && u <= math.MaxUint32 {
+		btime = uint32(u)
+	}
+
+	b[0] = byte(s.Flags)
+	b[1] = version
+	// ac_tty is unknown and left zero.
+	order.PutUint32(b[4:8], s.ExitCode)
+	order.PutUint32(b[8:12], s.UID)
+	order.PutUint32(b[12:16], s.GID)
+	order.PutUint32(b[16:20], uint32(s.PID))
+	order.PutUint32(b[20:24], uint32(s.PPID))
+	order.PutUint32(b[24:28], btime)
+	order.PutUint32(b[28:32], math.Float32bits(float32(acctTicks(s.ElapsedTime))))
+	order.PutUint16(b[32:34], encodeCompT(acctTicks(s.UserCPUTime)))
+	order.PutUint16(b[34:36], encodeCompT(acctTicks(s.SystemCPUTime)))
+	order.PutUint16(b[36:38], encodeCompT(s.PeakVirtualMemory/1024))
+	// ac_io and ac_rw are always zero, as written by the kernel.
+	order.PutUint16(b[42:44], encodeCompT(s.MinorPageFaults))
+	order.PutUint16(b[44:46], encodeCompT(s.MajorPageFaults))
+	// ac_swaps is always zero, as written by the kernel.
+
+	// Leave room for the NUL terminator.
+	comm := s.Comm
+	if len(comm) > acctCommLen-1 {
+		comm = comm[:acctCommLen-1]
+	}
+	copy(b[48:48+acctCommLen], comm)
+}
+
+// An AcctReader reads BSD process accounting records in the acct_v3 format
+// described by acct(5), such as those written by the kernel to
+// /var/account/pacct or by an AcctWriter, and maps them onto Stats.
+//
+// The identifiers, command name, exit code, flags, begin time, elapsed time,
+// CPU times, and page fault counts of each record are reported. The memory
+// usage of a record, which is the virtual memory size of the process when it
+// exited, is reported as PeakVirtualMemory, which it approximates. Process
+// accounting does not measure delays, so NoDelays is set.
+//
+// Records in either byte order are accepted, as indicated by the version of
+// each record. Times and memory usage are stored with reduced precision by
+// the kernel, so they may differ slightly from those reported by taskstats.
+type AcctReader struct {
+	r io.Reader
+	b [sizeofAcctV3]byte
+}
+
+// NewAcctReader creates an AcctReader which reads records from r.
+func NewAcctReader(r io.Reader) *AcctReader {
+	return &AcctReader{r: r}
+}
+
+// Read reads the next record. At the end of the input, Read returns io.EOF.
+// If the input ends partway through a record, Read returns
+// io.ErrUnexpectedEOF.
+func (r *AcctReader) Read() (*Stats, error) {
+	if _, err := io.ReadFull(r.r, r.b[:]); err != nil {
+		return nil, err
+	}
+
+	return parseAcctV3(r.b[:])
+}
+
+// parseAcctV3 parses a struct acct_v3 from b.
+func parseAcctV3(b []byte) (*Stats, error) {
+	_ = b[sizeofAcctV3-1]
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if b[1]&acctByteOrder != 0 {
+		order = binary.BigEndian
+	}
+
+	if v := b[1] &^ acctByteOrder; v != acctV3 {
+		return nil, fmt.Errorf("taskstats: unsupported acct record version %d", v)
+	}
+
+	comm := b[48 : 48+acctCommLen]
+	if i := bytes.IndexByte(comm, 0); i != -1 {
+		comm = comm[:i]
+	}
+
+	var begin time.Time
+	if btime := order.Uint32(b[24:28]); btime != 0 {
+		begin = time.Unix(int64(btime), 0)
+	}
+
+	return &Stats{
+		PID:               int(order.Uint32(b[16:20])),
+		PPID:              int(order.Uint32(b[20:24])),
+		UID:               order.Uint32(b[8:12]),
+		GID:               order.Uint32(b[12:16]),
+		Comm:              string(comm),
+		ExitCode:          order.Uint32(b[4:8]),
+		Flags:             AccountingFlags(b[0]),
+		BeginTime:         begin,
+		ElapsedTime:       acctDuration(float64(math.Float32frombits(order.Uint32(b[28:32])))),
+		UserCPUTime:       acctDuration(float64(decodeCompT(order.Uint16(b[32:34])))),
+		SystemCPUTime:     acctDuration(float64(decodeCompT(order.Uint16(b[34:36])))),
+		MinorPageFaults:   decodeCompT(order.Uint16(b[42:44])),
+		MajorPageFaults:   decodeCompT(order.Uint16(b[44:46])),
+		PeakVirtualMemory: decodeCompT(order.Uint16(b[36:38])) * 1024,
+		NoDelays:          true,
+	}, nil
+}
+
+// acctDuration converts acct_v3 clock ticks into a time.Duration.
+func acctDuration(ticks float64) time.Duration {
+	return time.Duration(ticks * float64(time.Second/acctHZ))
+}
+
+// acctTicks converts d into acct_v3 clock ticks.
+func acctTicks(d time.Duration) uint64 {
+	if d <= 0 {
+		return 0
+	}
+
+	return uint64(d / (time.Second / acctHZ))
+}
+
+// encodeCompT encodes v as a comp_t: a 13-bit mantissa and a 3-bit base 8
+// exponent, rounding as the kernel does. Values too large to represent are
+// clamped to the largest comp_t.
+func encodeCompT(v uint64) uint16 {
+	const (
+		mantSize = 13
+		expSize  = 3
+		maxFract = 1<<mantSize - 1
+		maxExp   = 1<<expSize - 1
+	)
+
+	var (
+		exp uint64
+		rnd bool
+	)
+
+	for v > maxFract {
+		rnd = v&(1<<(expSize-1)) != 0
+		v >>= expSize
+		exp++
+	}
+
+	if rnd {
+		v++
+		if v > maxFract {
+			v >>= expSize
+			exp++
+		}
+	}
+
+	if exp > maxExp {
+		return math.MaxUint16
+	}
+
+	return uint16(exp<<mantSize | v)
+}
+
+// decodeCompT decodes a comp_t produced by encodeCompT.
+func decodeCompT(c uint16) uint64 {
+	return uint64(c&0x1fff) << (3 * (c >> 13))
+}
@@ -0,0 +1,284 @@
+package taskstats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestEncodeCompT(t *testing.T) {
+	tests := []struct {
+		v    uint64
+		c    uint16
+		back uint64
+	}{
+		{v: 0, c: 0, back: 0},
+		{v: 8191, c: 8191, back: 8191},
+		// Exponent of 1 with the low bits truncated.
+		{v: 8192, c: 1<<13 | 1024, back: 8192},
+		{v: 8196, c: 1<<13 | 1025, back: 8200},
+		// Rounding up overflows the mantissa.
+		{v: 65535, c: 2<<13 | 1024, back: 65536},
+		{v: math.MaxUint64, c: math.MaxUint16, back: 8191 << 21},
+	}
+
+	for _, tt := range tests {
+		c := encodeCompT(tt.v)
+		if diff := cmp.Diff(tt.c, c); diff != "" {
+			t.Fatalf("unexpected comp_t for %d (-want +got):\n%s", tt.v, diff)
+		}
+
+		if diff := cmp.Diff(tt.back, decodeCompT(c)); diff != "" {
+			t.Fatalf("unexpected decoded comp_t for %d (-want +got):\n%s", tt.v, diff)
+		}
+	}
+}
+
+func TestAcctWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewAcctWriter(&buf)
+
+	// A thread exit and the exit of the leader before its threads only
+	// contribute their usage, and the thread group exit uses the thread
+	// group statistics and the time elapsed since the leader started.
+	exits := []Exit{
+		{PID: 11, Stats: &Stats{PID: 11, TGID: 10, UserCPUTime: 200 * time.Millisecond, MinorPageFaults: 2}},
+		{
+			PID: 10,
+			Stats: &Stats{
+				PID:              10,
+				TGID:             10,
+				BeginTime:        time.Unix(1700000000, 0),
+				ElapsedTime:      2500 * time.Millisecond,
+				GroupElapsedTime: 2500 * time.Millisecond,
+				UserCPUTime:      time.Second,
+				MinorPageFaults:  100,
+			},
+		},
+		{
+			PID: 12,
+			Stats: &Stats{
+				PID:               12,
+				PPID:              1,
+				TGID:              10,
+				UID:               1000,
+				GID:               100,
+				Comm:              "a-very-long-command-name",
+				ExitCode:          256,
+				Flags:             AccountingSuperuser,
+				BeginTime:         time.Unix(1700000001, 0),
+				ElapsedTime:       1400 * time.Millisecond,
+				GroupElapsedTime:  2500 * time.Millisecond,
+				UserCPUTime:       34 * time.Millisecond,
+				SystemCPUTime:     5 * time.Millisecond,
+				PeakVirtualMemory: 4 << 20,
+				MinorPageFaults:   7,
+				MajorPageFaults:   9000,
+			},
+			TGID: 10,
+			TGIDStats: &Stats{
+				ElapsedTime: 6400 * time.Millisecond,
+				CPUDelay:    time.Millisecond,
+			},
+		},
+	}
+
+	for _, e := range exits {
+		if err := w.WriteExit(e); err != nil {
+			t.Fatalf("failed to write exit: %v", err)
+		}
+	}
+
+	b := buf.Bytes()
+	if diff := cmp.Diff(sizeofAcctV3, len(b)); diff != "" {
+		t.Fatalf("unexpected record size (-want +got):\n%s", diff)
+	}
+
+	order := binary.NativeEndian
+	type record struct {
+		Flag, Version                 byte
+		ExitCode, UID, GID, PID, PPID uint32
+		BeginTime                     uint32
+		ElapsedTime                   float32
+		UTime, STime, Mem, MinF, MajF uint16
+		Comm                          string
+	}
+
+	got := record{
+		Flag:        b[0],
+		Version:     b[1] &^ acctByteOrder,
+		ExitCode:    order.Uint32(b[4:8]),
+		UID:         order.Uint32(b[8:12]),
+		GID:         order.Uint32(b[12:16]),
+		PID:         order.Uint32(b[16:20]),
+		PPID:        order.Uint32(b[20:24]),
+		BeginTime:   order.Uint32(b[24:28]),
+		ElapsedTime: math.Float32frombits(order.Uint32(b[28:32])),
+		UTime:       order.Uint16(b[32:34]),
+		STime:       order.Uint16(b[34:36]),
+		Mem:         order.Uint16(b[36:38]),
+		MinF:        order.Uint16(b[42:44]),
+		MajF:        order.Uint16(b[44:46]),
+		Comm:        string(b[48:64]),
+	}
+
+	want := record{
+		Flag:        byte(AccountingSuperuser),
+		Version:     acctV3,
+		ExitCode:    256,
+		UID:         1000,
+		GID:         100,
+		PID:         10,
+		PPID:        1,
+		BeginTime:   1700000000,
+		ElapsedTime: 250,
+		UTime:       123,
+		STime:       0,
+		Mem:         encodeCompT(4096),
+		MinF:        encodeCompT(109),
+		MajF:        encodeCompT(9000),
+		Comm:        "a-very-long-com\x00",
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected record (-want +got):\n%s", diff)
+	}
+}
+
+func TestAcctReader(t *testing.T) {
+	in := []*Stats{
+		{
+			PID:               10,
+			PPID:              1,
+			UID:               1000,
+			GID:               100,
+			Comm:              "sleep",
+			ExitCode:          256,
+			Flags:             AccountingForked | AccountingKilled,
+			BeginTime:         time.Unix(1700000000, 0),
+			ElapsedTime:       2500 * time.Millisecond,
+			UserCPUTime:       1230 * time.Millisecond,
+			SystemCPUTime:     10 * time.Millisecond,
+			MinorPageFaults:   7,
+			MajorPageFaults:   8192,
+			PeakVirtualMemory: 4 << 20,
+			// Delays are not recorded.
+			CPUDelayCount: 1,
+			CPUDelay:      time.Second,
+		},
+		{PID: 11},
+	}
+
+	var buf bytes.Buffer
+	w := NewAcctWriter(&buf)
+	for _, s := range in {
+		if err := w.WriteStats(s); err != nil {
+			t.Fatalf("failed to write stats: %v", err)
+		}
+	}
+
+	var got []*Stats
+	r := NewAcctReader(&buf)
+	for {
+		s, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("failed to read stats: %v", err)
+		}
+
+		got = append(got, s)
+	}
+
+	want := []*Stats{
+		{
+			PID:               10,
+			PPID:              1,
+			UID:               1000,
+			GID:               100,
+			Comm:              "sleep",
+			ExitCode:          256,
+			Flags:             AccountingForked | AccountingKilled,
+			BeginTime:         time.Unix(1700000000, 0),
+			ElapsedTime:       2500 * time.Millisecond,
+			UserCPUTime:       1230 * time.Millisecond,
+			SystemCPUTime:     10 * time.Millisecond,
+			MinorPageFaults:   7,
+			MajorPageFaults:   8192,
+			PeakVirtualMemory: 4 << 20,
+			NoDelays:          true,
+		},
+		{PID: 11, NoDelays: true},
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected stats (-want +got):\n%s", diff)
+	}
+}
+
+func TestAcctReaderBigEndian(t *testing.T) {
+	b := make([]byte, sizeofAcctV3)
+	b[1] = acctV3 | acctByteOrder
+	binary.BigEndian.PutUint32(b[16:20], 10)
+	binary.BigEndian.PutUint32(b[28:32], math.Float32bits(100))
+	binary.BigEndian.PutUint16(b[32:34], encodeCompT(50))
+	copy(b[48:], "cron")
+
+	s, err := NewAcctReader(bytes.NewReader(b)).Read()
+	if err != nil {
+		t.Fatalf("failed to read stats: %v", err)
+	}
+
+	want := &Stats{
+		PID:         10,
+		Comm:        "cron",
+		ElapsedTime: time.Second,
+		UserCPUTime: 500 * time.Millisecond,
+		NoDelays:    true,
+	}
+
+	if diff := cmp.Diff(want, s); diff != "" {
+		t.Fatalf("unexpected stats (-want +got):\n%s", diff)
+	}
+}
+
+func TestAcctReaderError(t *testing.T) {
+	v2 := make([]byte, sizeofAcctV3)
+	v2[1] = 2
+
+	tests := []struct {
+		name string
+		b    []byte
+		err  error
+	}{
+		{
+			name: "truncated",
+			b:    make([]byte, sizeofAcctV3-1),
+			err:  io.ErrUnexpectedEOF,
+		},
+		{
+			name: "version 2",
+			b:    v2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewAcctReader(bytes.NewReader(tt.b)).Read()
+			if err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,399 @@
+package taskstats
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// binaryVersion is the version of the binary encoding of Stats and Exit.
+const binaryVersion = 1
+
+var (
+	_ encoding.BinaryMarshaler   = Stats{}
+	_ encoding.BinaryUnmarshaler = &Stats{}
+	_ encoding.BinaryMarshaler   = Exit{}
+	_ encoding.BinaryUnmarshaler = &Exit{}
+)
+
+// Wire types of binary encoding fields.
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+// Field tags of the binary encoding of Stats. Tags must never be reused.
+const (
+	_ = iota
+	tagStatsPID
+	tagStatsPPID
+	tagStatsTGID
+	tagStatsBeginTime
+	tagStatsElapsedTime
+	tagStatsUserCPUTime
+	tagStatsSystemCPUTime
+	tagStatsMinorPageFaults
+	tagStatsMajorPageFaults
+	tagStatsCPUDelayCount
+	tagStatsCPUDelay
+	tagStatsBlockIODelayCount
+	tagStatsBlockIODelay
+	tagStatsSwapInDelayCount
+	tagStatsSwapInDelay
+	tagStatsFreePagesDelayCount
+	tagStatsFreePagesDelay
+	tagStatsThrashingDelayCount
+	tagStatsThrashingDelay
+	tagStatsUID
+	tagStatsGID
+	tagStatsComm
+	tagStatsExitCode
+	tagStatsFlags
+	tagStatsPeakRSS
+	tagStatsPeakVirtualMemory
+	tagStatsNoDelays
+	tagStatsReadBytes
+	tagStatsWriteBytes
+	tagStatsGroupElapsedTime
+)
+
+// Field tags of the binary encoding of Exit. Tags must never be reused.
+const (
+	_ = iota
+	tagExitPID
+	tagExitStats
+	tagExitTGID
+	tagExitTGIDStats
+	tagExitTime
+)
+
+// errBinaryTruncated is returned when a binary encoding ends unexpectedly.
+var errBinaryTruncated = errors.New("taskstats: truncated binary encoding")
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+//
+// The encoding begins with a version byte, currently 1, followed by a
+// sequence of fields. Each field is a varint key holding the field's tag
+// shifted left by three bits and combined with its wire type, followed by
+// the field's value: a varint for wire type 0, or a varint length and that
+// many bytes for wire type 2. Signed values use zig-zag encoding, as in
+// encoding/binary.PutVarint, and fields with zero values are omitted.
+// BeginTime is encoded as nanoseconds since the Unix epoch.
+//
+// Decoders skip fields with unknown tags, so fields may be added to the
+// encoding without changing its version.
+func (s Stats) MarshalBinary() ([]byte, error) {
+	return s.appendBinary([]byte{binaryVersion}), nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler, decoding the
+// encoding produced by MarshalBinary.
+func (s *Stats) UnmarshalBinary(b []byte) error {
+	b, err := checkBinaryVersion("Stats", b)
+	if err != nil {
+		return err
+	}
+
+	return s.decodeBinary(b)
+}
+
+// appendBinary appends the fields of s to b.
+func (s *Stats) appendBinary(b []byte) []byte {
+	e := binaryEncoder{b: b}
+
+	e.int(tagStatsPID, int64(s.PID))
+	e.int(tagStatsPPID, int64(s.PPID))
+	e.int(tagStatsTGID, int64(s.TGID))
+	if !s.BeginTime.IsZero() {
+		e.key(tagStatsBeginTime, wireVarint)
+		e.b = binary.AppendVarint(e.b, s.BeginTime.UnixNano())
+	}
+	e.int(tagStatsElapsedTime, int64(s.ElapsedTime))
+	e.int(tagStatsUserCPUTime, int64(s.UserCPUTime))
+	e.int(tagStatsSystemCPUTime, int64(s.SystemCPUTime))
+	e.uint(tagStatsMinorPageFaults, s.MinorPageFaults)
+	e.uint(tagStatsMajorPageFaults, s.MajorPageFaults)
+	e.uint(tagStatsCPUDelayCount, s.CPUDelayCount)
+	e.int(tagStatsCPUDelay, int64(s.CPUDelay))
+	e.uint(tagStatsBlockIODelayCount, s.BlockIODelayCount)
+	e.int(tagStatsBlockIODelay, int64(s.BlockIODelay))
+	e.uint(tagStatsSwapInDelayCount, s.SwapInDelayCount)
+	e.int(tagStatsSwapInDelay, int64(s.SwapInDelay))
+	e.uint(tagStatsFreePagesDelayCount, s.FreePagesDelayCount)
+	e.int(tagStatsFreePagesDelay, int64(s.FreePagesDelay))
+	e.uint(tagStatsThrashingDelayCount, s.ThrashingDelayCount)
+	e.int(tagStatsThrashingDelay, int64(s.ThrashingDelay))
+	e.uint(tagStatsUID, uint64(s.UID))
+	e.uint(tagStatsGID, uint64(s.GID))
+	e.bytes(tagStatsComm, []byte(s.Comm))
+	e.uint(tagStatsExitCode, uint64(s.ExitCode))
+	e.uint(tagStatsFlags, uint64(s.Flags))
+	e.uint(tagStatsPeakRSS, s.PeakRSS)
+	e.uint(tagStatsPeakVirtualMemory, s.PeakVirtualMemory)
+	if s.NoDelays {
+		e.uint(tagStatsNoDelays, 1)
+	}
+	e.uint(tagStatsReadBytes, s.ReadBytes)
+	e.uint(tagStatsWriteBytes, s.WriteBytes)
+	e.int(tagStatsGroupElapsedTime, int64(s.GroupElapsedTime))
+
+	return e.b
+}
+
+// decodeBinary decodes the fields in b into s.
+func (s *Stats) decodeBinary(b []byte) error {
+	*s = Stats{}
+
+	return decodeBinaryFields(b, func(tag uint64, v uint64, data []byte) {
+		if data != nil {
+			// Comm is the only Stats field which is not a varint.
+			if tag == tagStatsComm {
+				s.Comm = string(data)
+			}
+
+			return
+		}
+
+		switch tag {
+		case tagStatsPID:
+			s.PID = int(zigzag(v))
+		case tagStatsPPID:
+			s.PPID = int(zigzag(v))
+		case tagStatsTGID:
+			s.TGID = int(zigzag(v))
+		case tagStatsBeginTime:
+			s.BeginTime = time.Unix(0, zigzag(v))
+		case tagStatsElapsedTime:
+			s.ElapsedTime = time.Duration(zigzag(v))
+		case tagStatsUserCPUTime:
+			s.UserCPUTime = time.Duration(zigzag(v))
+		case tagStatsSystemCPUTime:
+			s.SystemCPUTime = time.Duration(zigzag(v))
+		case tagStatsMinorPageFaults:
+			s.MinorPageFaults = v
+		case tagStatsMajorPageFaults:
+			s.MajorPageFaults = v
+		case tagStatsCPUDelayCount:
+			s.CPUDelayCount = v
+		case tagStatsCPUDelay:
+			s.CPUDelay = time.Duration(zigzag(v))
+		case tagStatsBlockIODelayCount:
+			s.BlockIODelayCount = v
+		case tagStatsBlockIODelay:
+			s.BlockIODelay = time.Duration(zigzag(v))
+		case tagStatsSwapInDelayCount:
+			s.SwapInDelayCount = v
+		case tagStatsSwapInDelay:
+			s.SwapInDelay = time.Duration(zigzag(v))
+		case tagStatsFreePagesDelayCount:
+			s.FreePagesDelayCount = v
+		case tagStatsFreePagesDelay:
+			s.FreePagesDelay = time.Duration(zigzag(v))
+		case tagStatsThrashingDelayCount:
+			s.ThrashingDelayCount = v
+		case tagStatsThrashingDelay:
+			s.ThrashingDelay = time.Duration(zigzag(v))
+		case tagStatsUID:
+			s.UID = uint32(v)
+		case tagStatsGID:
+			s.GID = uint32(v)
+		case tagStatsExitCode:
+			s.ExitCode = uint32(v)
+		case tagStatsFlags:
+			s.Flags = AccountingFlags(v)
+		case tagStatsPeakRSS:
+			s.PeakRSS = v
+		case tagStatsPeakVirtualMemory:
+			s.PeakVirtualMemory = v
+		case tagStatsNoDelays:
+			s.NoDelays = v != 0
+		case tagStatsReadBytes:
+			s.ReadBytes = v
+		case tagStatsWriteBytes:
+			s.WriteBytes = v
+		case tagStatsGroupElapsedTime:
+			s.GroupElapsedTime = time.Duration(zigzag(v))
+		}
+	})
+}
+
+// MarshalBinary implements encoding.BinaryMarshaler.
+//
+// The encoding uses the same format as Stats.MarshalBinary. Stats and
+// TGIDStats are encoded as wire type 2 fields containing the fields of the
+// Stats without a version byte, and are omitted if nil. Time is encoded like
+// Stats.BeginTime.
+func (e Exit) MarshalBinary() ([]byte, error) {
+	enc := binaryEncoder{b: []byte{binaryVersion}}
+
+	enc.int(tagExitPID, int64(e.PID))
+	enc.stats(tagExitStats, e.Stats)
+	enc.int(tagExitTGID, int64(e.TGID))
+	enc.stats(tagExitTGIDStats, e.TGIDStats)
+	if !e.Time.IsZero() {
+		enc.key(tagExitTime, wireVarint)
+		enc.b = binary.AppendVarint(enc.b, e.Time.UnixNano())
+	}
+
+	return enc.b, nil
+}
+
+// UnmarshalBinary implements encoding.BinaryUnmarshaler, decoding the
+// encoding produced by MarshalBinary.
+func (e *Exit) UnmarshalBinary(b []byte) error {
+	b, err := checkBinaryVersion("Exit", b)
+	if err != nil {
+		return err
+	}
+
+	var (
+		out  Exit
+		serr error
+	)
+
+	decodeStats := func(b []byte) *Stats {
+		s := new(Stats)
+		if err := s.decodeBinary(b); err != nil && serr == nil {
+			serr = err
+		}
+
+		return s
+	}
+
+	err = decodeBinaryFields(b, func(tag uint64, v uint64, b []byte) {
+		switch {
+		case tag == tagExitPID && b == nil:
+			out.PID = int(zigzag(v))
+		case tag == tagExitStats && b != nil:
+			out.Stats = decodeStats(b)
+		case tag == tagExitTGID && b == nil:
+			out.TGID = int(zigzag(v))
+		case tag == tagExitTGIDStats && b != nil:
+			out.TGIDStats = decodeStats(b)
+		case tag == tagExitTime && b == nil:
+			out.Time = time.Unix(0, zigzag(v))
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if serr != nil {
+		return serr
+	}
+
+	*e = out
+	return nil
+}
+
+// A binaryEncoder appends fields to a binary encoding.
+type binaryEncoder struct {
+	b []byte
+}
+
+// key appends the key of a field.
+func (e *binaryEncoder) key(tag uint64, wire uint64) {
+	e.b = binary.AppendUvarint(e.b, tag<<3|wire)
+}
+
+// int appends a signed field if v is non-zero.
+func (e *binaryEncoder) int(tag uint64, v int64) {
+	if v == 0 {
+		return
+	}
+
+	e.key(tag, wireVarint)
+	e.b = binary.AppendVarint(e.b, v)
+}
+
+// uint appends an unsigned field if v is non-zero.
+func (e *binaryEncoder) uint(tag uint64, v uint64) {
+	if v == 0 {
+		return
+	}
+
+	e.key(tag, wireVarint)
+	e.b = binary.AppendUvarint(e.b, v)
+}
+
+// bytes appends a bytes field if b is not empty.
+func (e *binaryEncoder) bytes(tag uint64, b []byte) {
+	if len(b) == 0 {
+		return
+	}
+
+	e.key(tag, wireBytes)
+	e.b = binary.AppendUvarint(e.b, uint64(len(b)))
+	e.b = append(e.b, b...)
+}
+
+// stats appends a field containing the fields of s if s is not nil.
+func (e *binaryEncoder) stats(tag uint64, s *Stats) {
+	if s == nil {
+		return
+	}
+
+	// An empty Stats must still be distinguished from nil.
+	fields := s.appendBinary(nil)
+	e.key(tag, wireBytes)
+	e.b = binary.AppendUvarint(e.b, uint64(len(fields)))
+	e.b = append(e.b, fields...)
+}
+
+// checkBinaryVersion verifies that the binary encoding of typ in b uses a
+// supported version, and returns the fields which follow the version.
+func checkBinaryVersion(typ string, b []byte) ([]byte, error) {
+	if len(b) == 0 {
+		return nil, errBinaryTruncated
+	}
+
+	if b[0] != binaryVersion {
+		return nil, fmt.Errorf("taskstats: unsupported %s binary version %d", typ, b[0])
+	}
+
+	return b[1:], nil
+}
+
+// decodeBinaryFields calls fn for each field in b. For wire type 0 fields, v
+// is the raw varint value and data is nil. For wire type 2 fields, data is
+// the field's bytes, which is non-nil even if empty.
+func decodeBinaryFields(b []byte, fn func(tag uint64, v uint64, data []byte)) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errBinaryTruncated
+		}
+		b = b[n:]
+
+		tag, wire := key>>3, key&7
+		switch wire {
+		case wireVarint:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return errBinaryTruncated
+			}
+			b = b[n:]
+
+			fn(tag, v, nil)
+		case wireBytes:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || l > uint64(len(b[n:])) {
+				return errBinaryTruncated
+			}
+			b = b[n:]
+
+			fn(tag, 0, b[:l])
+			b = b[l:]
+		default:
+			return fmt.Errorf("taskstats: unknown binary wire type %d for field %d", wire, tag)
+		}
+	}
+
+	return nil
+}
+
+// zigzag decodes a zig-zag encoded signed varint value.
+func zigzag(v uint64) int64 {
+	return int64(v>>1) ^ -int64(v&1)
+}
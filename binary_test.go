@@ -0,0 +1,173 @@
+package taskstats
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStatsBinary(t *testing.T) {
+	tests := []struct {
+		name string
+		s    Stats
+		b    []byte
+	}{
+		{
+			name: "zero",
+			b:    []byte{binaryVersion},
+		},
+		{
+			name: "epoch begin time",
+			s:    Stats{BeginTime: time.Unix(0, 0)},
+			b:    []byte{binaryVersion, tagStatsBeginTime << 3, 0x00},
+		},
+		{
+			name: "some fields",
+			s:    Stats{PID: 1, MajorPageFaults: 300, CPUDelay: -1},
+			b: []byte{
+				binaryVersion,
+				tagStatsPID << 3, 0x02,
+				tagStatsMajorPageFaults << 3, 0xac, 0x02,
+				tagStatsCPUDelay << 3, 0x01,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := tt.s.MarshalBinary()
+			if err != nil {
+				t.Fatalf("failed to marshal: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.b, b); diff != "" {
+				t.Fatalf("unexpected bytes (-want +got):\n%s", diff)
+			}
+
+			var s Stats
+			if err := s.UnmarshalBinary(b); err != nil {
+				t.Fatalf("failed to unmarshal: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.s, s); diff != "" {
+				t.Fatalf("unexpected Stats (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExitBinary(t *testing.T) {
+	tests := []struct {
+		name string
+		e    Exit
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "process",
+			e: Exit{
+				PID:   10,
+				Stats: &Stats{PID: 10, PPID: 1, Comm: "sleep", UID: 1000, BeginTime: time.Unix(1, 5), ElapsedTime: time.Hour, PeakRSS: 4096, ReadBytes: 512, NoDelays: true},
+			},
+		},
+		{
+			name: "thread group",
+			e: Exit{
+				PID:       11,
+				Stats:     &Stats{PID: 11, TGID: 10, UserCPUTime: time.Second},
+				TGID:      10,
+				TGIDStats: &Stats{UserCPUTime: 3 * time.Second},
+				Time:      time.Unix(100, 5),
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := tt.e.MarshalBinary()
+			if err != nil {
+				t.Fatalf("failed to marshal: %v", err)
+			}
+
+			var e Exit
+			if err := e.UnmarshalBinary(b); err != nil {
+				t.Fatalf("failed to unmarshal: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.e, e); diff != "" {
+				t.Fatalf("unexpected Exit (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestBinaryUnknownFields(t *testing.T) {
+	// A newer encoder adds a varint field and a bytes field.
+	b := []byte{binaryVersion, tagStatsPID << 3, 0x02}
+	b = binary.AppendUvarint(b, 100<<3|wireVarint)
+	b = binary.AppendUvarint(b, 12345)
+	b = binary.AppendUvarint(b, 101<<3|wireBytes)
+	b = binary.AppendUvarint(b, 3)
+	b = append(b, "foo"...)
+	b = append(b, tagStatsPPID<<3, 0x04)
+
+	// A known field with an unexpected wire type is also skipped.
+	b = append(b, tagStatsUserCPUTime<<3|wireBytes, 0x01, 0xff)
+
+	var s Stats
+	if err := s.UnmarshalBinary(b); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+
+	if diff := cmp.Diff(Stats{PID: 1, PPID: 2}, s); diff != "" {
+		t.Fatalf("unexpected Stats (-want +got):\n%s", diff)
+	}
+}
+
+func TestBinaryUnmarshalError(t *testing.T) {
+	tests := []struct {
+		name string
+		b    []byte
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name: "future version",
+			b:    []byte{binaryVersion + 1},
+		},
+		{
+			name: "truncated key",
+			b:    []byte{binaryVersion, 0x80},
+		},
+		{
+			name: "truncated varint",
+			b:    []byte{binaryVersion, tagStatsPID << 3},
+		},
+		{
+			name: "truncated bytes",
+			b:    []byte{binaryVersion, 15<<3 | wireBytes, 0x05, 0x00},
+		},
+		{
+			name: "unknown wire type",
+			b:    []byte{binaryVersion, tagStatsPID<<3 | 5, 0x00},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var s Stats
+			if err := s.UnmarshalBinary(tt.b); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+
+			var e Exit
+			if err := e.UnmarshalBinary(tt.b); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
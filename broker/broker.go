@@ -0,0 +1,113 @@
+// Package broker provides privilege separation for taskstats: a privileged
+// Server owns a taskstats.Client and serves requests from unprivileged
+// processes over a Unix socket, and a Client makes those requests.
+//
+// The Server identifies each connecting process using the SO_PEERCRED socket
+// option and authorizes each request against that identity, so that, by
+// default, a process may only retrieve the statistics of its own thread group
+// or of processes owned by the same user.
+//
+// Requests and responses are newline-delimited JSON objects, using the JSON
+// encoding of taskstats.Stats and taskstats.CGroupStats.
+package broker
+
+import (
+	"errors"
+	"os"
+	"time"
+
+	"github.com/mdlayher/taskstats"
+)
+
+// A Querier retrieves statistics for tasks and cgroups. Both
+// *taskstats.Client and *Client implement Querier, so callers may use either
+// directly or through the broker.
+type Querier interface {
+	CGroupStats(path string) (*taskstats.CGroupStats, error)
+	PID(pid int) (*taskstats.Stats, error)
+	TGID(tgid int) (*taskstats.Stats, error)
+	Self() (*taskstats.Stats, error)
+	Close() error
+}
+
+var (
+	_ Querier = &taskstats.Client{}
+	_ Querier = &Client{}
+)
+
+// A Peer is the identity of a process connected to a Server, as reported by
+// the kernel when the process connected.
+type Peer struct {
+	PID int
+	UID uint32
+	GID uint32
+}
+
+// Operations which may be requested of a Server.
+const (
+	opPID    = "pid"
+	opTGID   = "tgid"
+	opCGroup = "cgroup"
+	opExits  = "exits"
+)
+
+// Error codes which are translated to sentinel errors by a Client.
+const (
+	codeNotExist   = "not_exist"
+	codePermission = "permission"
+)
+
+// A request is a request from a Client to a Server.
+type request struct {
+	Op   string `json:"op"`
+	ID   int    `json:"id,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+// A response is a response from a Server to a Client. For an exits request,
+// a response is sent for each exit event.
+type response struct {
+	Stats       *taskstats.Stats       `json:"stats,omitempty"`
+	CGroupStats *taskstats.CGroupStats `json:"cgroup_stats,omitempty"`
+	Exit        *exit                  `json:"exit,omitempty"`
+	Error       string                 `json:"error,omitempty"`
+	Code        string                 `json:"code,omitempty"`
+}
+
+// An exit is the JSON encoding of a taskstats.Exit.
+type exit struct {
+	PID       int              `json:"pid"`
+	Stats     *taskstats.Stats `json:"stats"`
+	TGID      int              `json:"tgid,omitempty"`
+	TGIDStats *taskstats.Stats `json:"tgid_stats,omitempty"`
+	Time      time.Time        `json:"time"`
+}
+
+// errorResponse creates a response describing err.
+func errorResponse(err error) response {
+	res := response{Error: err.Error()}
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		res.Code = codeNotExist
+	case errors.Is(err, os.ErrPermission):
+		res.Code = codePermission
+	}
+
+	return res
+}
+
+// responseError returns the error described by res, if any. Errors with known
+// codes are returned as the corresponding sentinel errors, so they may be
+// checked using os.IsNotExist and os.IsPermission.
+func responseError(res response) error {
+	switch {
+	case res.Code == codeNotExist:
+		return os.ErrNotExist
+	case res.Code == codePermission:
+		return os.ErrPermission
+	case res.Error != "":
+		return errors.New(res.Error)
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,308 @@
+//go:build linux
+// +build linux
+
+package broker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/taskstats"
+)
+
+func TestBroker(t *testing.T) {
+	uid := uint32(os.Getuid())
+
+	q := &testQuerier{
+		stats: map[int]*taskstats.Stats{
+			1: {PID: 1, TGID: 1, UID: uid, Comm: "mine"},
+			2: {PID: 2, TGID: 2, UID: uid + 1, Comm: "theirs"},
+		},
+	}
+
+	exits := &testExitStream{exitC: make(chan taskstats.Exit, 2)}
+	exits.exitC <- taskstats.Exit{PID: 2, Stats: q.stats[2]}
+	exits.exitC <- taskstats.Exit{PID: 1, Stats: q.stats[1], Time: time.Unix(100, 0)}
+
+	// Only the cgroup directory foo is allowed, so a symlink to it from
+	// outside of the cgroup filesystem must be rejected.
+	foo, bar := testCGroupDirs(t)
+	tmp := t.TempDir()
+	link := filepath.Join(tmp, "link")
+	if err := os.Symlink(foo, link); err != nil {
+		t.Fatalf("failed to create symlink: %v", err)
+	}
+
+	fooInfo, err := os.Stat(foo)
+	if err != nil {
+		t.Fatalf("failed to stat directory: %v", err)
+	}
+
+	// Authorize by user even when running as the superuser.
+	cfg := &ServerConfig{
+		AllowTask: func(p Peer, s *taskstats.Stats) bool { return s.UID == p.UID },
+		AllowCGroup: func(p Peer, dir *os.File) bool {
+			fi, err := dir.Stat()
+			return err == nil && os.SameFile(fi, fooInfo)
+		},
+		MaxExitStreams: 1,
+	}
+
+	c := testBroker(t, newServer(q, func() (exitStream, error) { return exits, nil }, cfg))
+
+	t.Run("PID", func(t *testing.T) {
+		stats, err := c.PID(1)
+		if err != nil {
+			t.Fatalf("failed to get PID stats: %v", err)
+		}
+
+		if diff := cmp.Diff(q.stats[1], stats); diff != "" {
+			t.Fatalf("unexpected stats (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("TGID", func(t *testing.T) {
+		stats, err := c.TGID(1)
+		if err != nil {
+			t.Fatalf("failed to get TGID stats: %v", err)
+		}
+
+		if diff := cmp.Diff(q.stats[1], stats); diff != "" {
+			t.Fatalf("unexpected stats (-want +got):\n%s", diff)
+		}
+	})
+
+	t.Run("denied", func(t *testing.T) {
+		if _, err := c.TGID(2); !os.IsPermission(err) {
+			t.Fatalf("expected permission denied, but got: %v", err)
+		}
+	})
+
+	t.Run("not exist", func(t *testing.T) {
+		if _, err := c.PID(3); !os.IsNotExist(err) {
+			t.Fatalf("expected not exist, but got: %v", err)
+		}
+	})
+
+	t.Run("cgroup", func(t *testing.T) {
+		stats, err := c.CGroupStats(foo)
+		if err != nil {
+			t.Fatalf("failed to get cgroup stats: %v", err)
+		}
+
+		if diff := cmp.Diff(&taskstats.CGroupStats{Running: 1}, stats); diff != "" {
+			t.Fatalf("unexpected cgroup stats (-want +got):\n%s", diff)
+		}
+
+		if _, err := c.CGroupStats(bar); !os.IsPermission(err) {
+			t.Fatalf("expected permission denied, but got: %v", err)
+		}
+
+		// Paths which are not allowed cgroups cannot be distinguished from
+		// one another.
+		for _, path := range []string{
+			link,
+			tmp,
+			filepath.Join(tmp, "baz"),
+			filepath.Join(foo, "taskstats-nonexistent"),
+			foo + "/../../../../etc",
+			DefaultCGroupRoot + "/../..",
+			"relative",
+		} {
+			if _, err := c.CGroupStats(path); !os.IsPermission(err) {
+				t.Fatalf("expected permission denied for %q, but got: %v", path, err)
+			}
+		}
+	})
+
+	t.Run("exits", func(t *testing.T) {
+		s, err := c.ListenExits()
+		if err != nil {
+			t.Fatalf("failed to listen for exits: %v", err)
+		}
+		defer s.Close()
+
+		select {
+		case e := <-s.Exits():
+			// Only the exit of the task owned by the same user is sent.
+			want := taskstats.Exit{PID: 1, Stats: q.stats[1], Time: time.Unix(100, 0)}
+			if diff := cmp.Diff(want, e); diff != "" {
+				t.Fatalf("unexpected exit (-want +got):\n%s", diff)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for exit")
+		}
+
+		// Only one stream is allowed at a time.
+		s2, err := c.ListenExits()
+		if err != nil {
+			t.Fatalf("failed to listen for exits: %v", err)
+		}
+		defer s2.Close()
+
+		for range s2.Exits() {
+		}
+		if err := s2.Err(); err == nil {
+			t.Fatal("expected an error for too many streams, but none occurred")
+		}
+
+		if err := s.Close(); err != nil {
+			t.Fatalf("failed to close stream: %v", err)
+		}
+
+		for range s.Exits() {
+		}
+		if err := s.Err(); err != nil {
+			t.Fatalf("unexpected stream error: %v", err)
+		}
+	})
+}
+
+func TestPeerCred(t *testing.T) {
+	l, path := testListener(t)
+
+	errC := make(chan error, 1)
+	go func() {
+		c, err := net.Dial("unix", path)
+		if err == nil {
+			defer c.Close()
+		}
+		errC <- err
+	}()
+
+	c, err := l.AcceptUnix()
+	if err != nil {
+		t.Fatalf("failed to accept: %v", err)
+	}
+	defer c.Close()
+
+	if err := <-errC; err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+
+	p, err := peerCred(c)
+	if err != nil {
+		t.Fatalf("failed to get peer credentials: %v", err)
+	}
+
+	want := Peer{PID: os.Getpid(), UID: uint32(os.Getuid()), GID: uint32(os.Getgid())}
+	if diff := cmp.Diff(want, p); diff != "" {
+		t.Fatalf("unexpected peer (-want +got):\n%s", diff)
+	}
+}
+
+// testCGroupDirs returns two distinct cgroup directories beneath
+// DefaultCGroupRoot, or skips the test if none are found.
+func testCGroupDirs(t *testing.T) (string, string) {
+	t.Helper()
+
+	des, err := os.ReadDir(DefaultCGroupRoot)
+	if err != nil {
+		t.Skipf("failed to read cgroup root: %v", err)
+	}
+
+	paths := []string{DefaultCGroupRoot}
+	for _, de := range des {
+		if de.IsDir() {
+			paths = append(paths, filepath.Join(DefaultCGroupRoot, de.Name()))
+		}
+	}
+
+	var dirs []string
+	for _, path := range paths {
+		f, err := taskstats.OpenCGroupDir(DefaultCGroupRoot, path)
+		if err != nil {
+			continue
+		}
+		_ = f.Close()
+
+		dirs = append(dirs, path)
+	}
+
+	if len(dirs) < 2 {
+		t.Skipf("found %d cgroup directories, need 2", len(dirs))
+	}
+
+	return dirs[0], dirs[1]
+}
+
+// testBroker runs s and returns a Client connected to it.
+func testBroker(t *testing.T, s *Server) *Client {
+	t.Helper()
+
+	l, path := testListener(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errC := make(chan error, 1)
+	go func() { errC <- s.Serve(ctx, l) }()
+
+	t.Cleanup(func() {
+		cancel()
+		if err := <-errC; !errors.Is(err, context.Canceled) {
+			t.Errorf("unexpected serve error: %v", err)
+		}
+	})
+
+	c, err := Dial(path)
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	t.Cleanup(func() { _ = c.Close() })
+
+	return c
+}
+
+// testListener creates a Unix socket listener in a temporary directory.
+func testListener(t *testing.T) (*net.UnixListener, string) {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "broker.sock")
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { _ = l.Close() })
+
+	return l, path
+}
+
+var _ querier = &testQuerier{}
+
+// A testQuerier is a querier which returns fixed statistics.
+type testQuerier struct {
+	stats map[int]*taskstats.Stats
+}
+
+func (q *testQuerier) CGroupStatsFile(f *os.File) (*taskstats.CGroupStats, error) {
+	return &taskstats.CGroupStats{Running: 1}, nil
+}
+
+func (q *testQuerier) PID(pid int) (*taskstats.Stats, error) {
+	s, ok := q.stats[pid]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+
+	return s, nil
+}
+
+func (q *testQuerier) TGID(tgid int) (*taskstats.Stats, error) {
+	return q.PID(tgid)
+}
+
+var _ exitStream = &testExitStream{}
+
+// A testExitStream is an exitStream which sends exits from a channel.
+type testExitStream struct {
+	exitC chan taskstats.Exit
+}
+
+func (s *testExitStream) Exits() <-chan taskstats.Exit { return s.exitC }
+func (s *testExitStream) Err() error                   { return nil }
+func (s *testExitStream) Close() error                 { return nil }
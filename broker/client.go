@@ -0,0 +1,212 @@
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/mdlayher/taskstats"
+)
+
+// A Client retrieves statistics from a Server. Its methods are safe for
+// concurrent use, although requests are made one at a time.
+type Client struct {
+	addr string
+
+	mu  sync.Mutex
+	c   net.Conn
+	enc *json.Encoder
+	dec *json.Decoder
+}
+
+// Dial creates a Client connected to the Server listening on the Unix socket
+// at path.
+func Dial(path string) (*Client, error) {
+	c, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Client{
+		addr: path,
+		c:    c,
+		enc:  json.NewEncoder(c),
+		dec:  json.NewDecoder(c),
+	}, nil
+}
+
+// Close closes the connection to the Server.
+func (c *Client) Close() error {
+	return c.c.Close()
+}
+
+// CGroupStats retrieves cgroup statistics for the cgroup specified by path.
+// The Server opens the directory at path, which must not be a symlink, and
+// retrieves its statistics as taskstats.Client.CGroupStatsFile does, so path
+// must be a directory in a cgroup v1 hierarchy.
+func (c *Client) CGroupStats(path string) (*taskstats.CGroupStats, error) {
+	res, err := c.do(request{Op: opCGroup, Path: path})
+	if err != nil {
+		return nil, err
+	}
+
+	return res.CGroupStats, nil
+}
+
+// Self retrieves statistics for the current process.
+func (c *Client) Self() (*taskstats.Stats, error) {
+	return c.TGID(os.Getpid())
+}
+
+// PID retrieves statistics for the thread specified by pid, as
+// taskstats.Client.PID does.
+func (c *Client) PID(pid int) (*taskstats.Stats, error) {
+	res, err := c.do(request{Op: opPID, ID: pid})
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Stats, nil
+}
+
+// TGID retrieves statistics for the thread group specified by tgid, as
+// taskstats.Client.TGID does.
+func (c *Client) TGID(tgid int) (*taskstats.Stats, error) {
+	res, err := c.do(request{Op: opTGID, ID: tgid})
+	if err != nil {
+		return nil, err
+	}
+
+	return res.Stats, nil
+}
+
+// do sends req and waits for its response.
+func (c *Client) do(req request) (response, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.enc.Encode(req); err != nil {
+		return response{}, err
+	}
+
+	var res response
+	if err := c.dec.Decode(&res); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+
+		return response{}, err
+	}
+
+	if err := responseError(res); err != nil {
+		return response{}, err
+	}
+
+	return res, nil
+}
+
+// ListenExits streams the exit events which the Server authorizes the caller
+// to see, using a new connection to the Server.
+func (c *Client) ListenExits() (*ExitStream, error) {
+	conn, err := net.Dial("unix", c.addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.NewEncoder(conn).Encode(request{Op: opExits}); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	s := &ExitStream{
+		c:     conn,
+		exitC: make(chan taskstats.Exit),
+		done:  make(chan struct{}),
+	}
+
+	go s.receive()
+
+	return s, nil
+}
+
+// An ExitStream receives exit events from a Server. Its methods mirror those
+// of taskstats.ExitListener.
+type ExitStream struct {
+	c     net.Conn
+	exitC chan taskstats.Exit
+	done  chan struct{}
+	once  sync.Once
+
+	mu  sync.Mutex
+	err error
+}
+
+// Exits returns a channel which receives an Exit for each task exit. The
+// channel is closed when the stream stops, after which Err reports the
+// reason.
+func (s *ExitStream) Exits() <-chan taskstats.Exit {
+	return s.exitC
+}
+
+// Err returns the error which stopped the stream, or nil if the stream was
+// closed by Close.
+func (s *ExitStream) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close stops the stream.
+func (s *ExitStream) Close() error {
+	s.once.Do(func() { close(s.done) })
+	return s.c.Close()
+}
+
+// receive decodes exit events until the connection fails.
+func (s *ExitStream) receive() {
+	defer close(s.exitC)
+
+	dec := json.NewDecoder(s.c)
+	for {
+		var res response
+		err := dec.Decode(&res)
+		if err == nil {
+			err = responseError(res)
+		}
+
+		switch {
+		case errors.Is(err, net.ErrClosed):
+			return
+		case errors.Is(err, io.EOF):
+			err = io.ErrUnexpectedEOF
+		}
+
+		if err != nil {
+			s.mu.Lock()
+			s.err = err
+			s.mu.Unlock()
+			return
+		}
+
+		if res.Exit == nil {
+			continue
+		}
+
+		e := taskstats.Exit{
+			PID:       res.Exit.PID,
+			Stats:     res.Exit.Stats,
+			TGID:      res.Exit.TGID,
+			TGIDStats: res.Exit.TGIDStats,
+			Time:      res.Exit.Time,
+		}
+
+		select {
+		case s.exitC <- e:
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,63 @@
+//go:build linux
+// +build linux
+
+package broker
+
+import (
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerCred returns the credentials of the process at the other end of c.
+func peerCred(c *net.UnixConn) (Peer, error) {
+	rc, err := c.SyscallConn()
+	if err != nil {
+		return Peer{}, err
+	}
+
+	var (
+		cred *unix.Ucred
+		cerr error
+	)
+	err = rc.Control(func(fd uintptr) {
+		cred, cerr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err != nil {
+		return Peer{}, err
+	}
+	if cerr != nil {
+		return Peer{}, os.NewSyscallError("getsockopt", cerr)
+	}
+
+	return Peer{
+		PID: int(cred.Pid),
+		UID: cred.Uid,
+		GID: cred.Gid,
+	}, nil
+}
+
+// fileOwner returns the UID which owns the open file f.
+func fileOwner(f *os.File) (uint32, error) {
+	rc, err := f.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		st   unix.Stat_t
+		serr error
+	)
+	err = rc.Control(func(fd uintptr) {
+		serr = unix.Fstat(int(fd), &st)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if serr != nil {
+		return 0, &os.PathError{Op: "fstat", Path: f.Name(), Err: serr}
+	}
+
+	return st.Uid, nil
+}
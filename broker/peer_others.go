@@ -0,0 +1,26 @@
+//go:build !linux
+// +build !linux
+
+package broker
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+)
+
+// errUnimplemented is returned by all functions on platforms that
+// cannot make use of the broker.
+var errUnimplemented = fmt.Errorf("broker: not implemented on %s/%s",
+	runtime.GOOS, runtime.GOARCH)
+
+// peerCred always returns an error.
+func peerCred(c *net.UnixConn) (Peer, error) {
+	return Peer{}, errUnimplemented
+}
+
+// fileOwner always returns an error.
+func fileOwner(f *os.File) (uint32, error) {
+	return 0, errUnimplemented
+}
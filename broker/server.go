@@ -0,0 +1,317 @@
+package broker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/mdlayher/taskstats"
+)
+
+// A ServerConfig configures a Server. The zero value is valid and uses the
+// default authorization policy.
+type ServerConfig struct {
+	// AllowTask reports whether p may retrieve the statistics s of a task,
+	// including its exit statistics. If nil, DefaultAllowTask is used.
+	AllowTask func(p Peer, s *taskstats.Stats) bool
+
+	// AllowCGroup reports whether p may retrieve the statistics of the
+	// cgroup whose directory has been opened as dir by the Server, using the
+	// path requested by p as its name. The statistics are retrieved using
+	// dir, so a policy which inspects dir rather than its name cannot be
+	// raced by renaming or replacing directories. If nil, DefaultAllowCGroup
+	// is used.
+	//
+	// Requested paths are resolved beneath CGroupRoot without following
+	// symlinks, and must name a directory in a cgroup filesystem. Requests
+	// for any other path, including paths which do not exist, are denied
+	// with the same permission error as requests denied by AllowCGroup, so
+	// clients cannot use the Server to probe the filesystem.
+	AllowCGroup func(p Peer, dir *os.File) bool
+
+	// CGroupRoot is the directory beneath which requested cgroup paths are
+	// resolved. If empty, DefaultCGroupRoot is used.
+	CGroupRoot string
+
+	// MaxExitStreams limits the number of clients which may stream exit
+	// events at once, as each is served by its own taskstats.ExitListener.
+	// Further requests fail until a stream is closed. If zero,
+	// DefaultMaxExitStreams is used.
+	MaxExitStreams int
+}
+
+// Default values for ServerConfig fields.
+const (
+	DefaultCGroupRoot     = "/sys/fs/cgroup"
+	DefaultMaxExitStreams = 8
+)
+
+// DefaultAllowTask allows the superuser to retrieve the statistics of any
+// task, and other processes to retrieve the statistics of their own threads
+// and of tasks owned by the same user.
+func DefaultAllowTask(p Peer, s *taskstats.Stats) bool {
+	return p.UID == 0 || s.PID == p.PID || s.TGID == p.PID || s.UID == p.UID
+}
+
+// DefaultAllowCGroup allows the superuser to retrieve the statistics of any
+// cgroup, and other processes to retrieve the statistics of cgroups whose
+// directory they own, such as those delegated to a user by systemd.
+func DefaultAllowCGroup(p Peer, dir *os.File) bool {
+	if p.UID == 0 {
+		return true
+	}
+
+	uid, err := fileOwner(dir)
+	return err == nil && uid == p.UID
+}
+
+// A Server serves taskstats requests over a Unix socket. A Server typically
+// runs with the privileges required by taskstats, while its clients do not.
+type Server struct {
+	q       querier
+	listen  func() (exitStream, error)
+	streams chan struct{}
+
+	allowTask   func(p Peer, s *taskstats.Stats) bool
+	allowCGroup func(p Peer, dir *os.File) bool
+	cgroupRoot  string
+}
+
+// querier is the subset of taskstats.Client used by a Server.
+type querier interface {
+	CGroupStatsFile(f *os.File) (*taskstats.CGroupStats, error)
+	PID(pid int) (*taskstats.Stats, error)
+	TGID(tgid int) (*taskstats.Stats, error)
+}
+
+// exitStream is the subset of taskstats.ExitListener used by a Server.
+type exitStream interface {
+	Exits() <-chan taskstats.Exit
+	Err() error
+	Close() error
+}
+
+// NewServer creates a Server which retrieves statistics using c. If cfg is
+// nil, a default configuration is used.
+//
+// Each client streaming exit events is served by its own
+// taskstats.ExitListener, up to ServerConfig.MaxExitStreams at once.
+func NewServer(c *taskstats.Client, cfg *ServerConfig) *Server {
+	return newServer(c, func() (exitStream, error) {
+		return taskstats.ListenExits(nil)
+	}, cfg)
+}
+
+// newServer creates a Server which retrieves statistics using q and exit
+// events using listen.
+func newServer(q querier, listen func() (exitStream, error), cfg *ServerConfig) *Server {
+	if cfg == nil {
+		cfg = &ServerConfig{}
+	}
+
+	streams := cfg.MaxExitStreams
+	if streams == 0 {
+		streams = DefaultMaxExitStreams
+	}
+
+	s := &Server{
+		q:           q,
+		listen:      listen,
+		streams:     make(chan struct{}, streams),
+		allowTask:   cfg.AllowTask,
+		allowCGroup: cfg.AllowCGroup,
+		cgroupRoot:  cfg.CGroupRoot,
+	}
+
+	if s.allowTask == nil {
+		s.allowTask = DefaultAllowTask
+	}
+	if s.allowCGroup == nil {
+		s.allowCGroup = DefaultAllowCGroup
+	}
+	if s.cgroupRoot == "" {
+		s.cgroupRoot = DefaultCGroupRoot
+	}
+
+	return s
+}
+
+// Serve accepts and serves connections on l until ctx is canceled or l fails.
+// When ctx is canceled, l and all connections are closed, and Serve returns
+// ctx.Err() once every connection has finished.
+func (s *Server) Serve(ctx context.Context, l *net.UnixListener) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stop := context.AfterFunc(ctx, func() { _ = l.Close() })
+	defer stop()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	for {
+		c, err := l.AcceptUnix()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer c.Close()
+
+			stop := context.AfterFunc(ctx, func() { _ = c.Close() })
+			defer stop()
+
+			_ = s.serveConn(c)
+		}()
+	}
+}
+
+// serveConn serves requests from a single connection until it is closed.
+func (s *Server) serveConn(c *net.UnixConn) error {
+	p, err := peerCred(c)
+	if err != nil {
+		return err
+	}
+
+	scan := bufio.NewScanner(c)
+	enc := json.NewEncoder(c)
+
+	for scan.Scan() {
+		var req request
+		if err := json.Unmarshal(scan.Bytes(), &req); err != nil {
+			return enc.Encode(errorResponse(fmt.Errorf("broker: malformed request: %v", err)))
+		}
+
+		if req.Op == opExits {
+			// The connection is dedicated to the stream from now on.
+			return s.streamExits(c, enc, p)
+		}
+
+		if err := enc.Encode(s.handle(p, req)); err != nil {
+			return err
+		}
+	}
+
+	return scan.Err()
+}
+
+// handle handles a single request from p.
+func (s *Server) handle(p Peer, req request) response {
+	switch req.Op {
+	case opPID:
+		stats, err := s.q.PID(req.ID)
+		if err != nil {
+			return errorResponse(err)
+		}
+		if !s.allowTask(p, stats) {
+			return errorResponse(os.ErrPermission)
+		}
+
+		return response{Stats: stats}
+	case opTGID:
+		// The kernel does not report the owner of a thread group, so
+		// authorize using the statistics of its leader.
+		leader, err := s.q.PID(req.ID)
+		if err != nil {
+			return errorResponse(err)
+		}
+		if !s.allowTask(p, leader) {
+			return errorResponse(os.ErrPermission)
+		}
+
+		stats, err := s.q.TGID(req.ID)
+		if err != nil {
+			return errorResponse(err)
+		}
+
+		return response{Stats: stats}
+	case opCGroup:
+		// Authorize and query the same directory, so it cannot be replaced
+		// between the two, such as by a symlink to another cgroup. Failing
+		// to open it is indistinguishable from being denied.
+		dir, err := taskstats.OpenCGroupDir(s.cgroupRoot, req.Path)
+		if err != nil {
+			return errorResponse(os.ErrPermission)
+		}
+		defer dir.Close()
+
+		if !s.allowCGroup(p, dir) {
+			return errorResponse(os.ErrPermission)
+		}
+
+		stats, err := s.q.CGroupStatsFile(dir)
+		if err != nil {
+			return errorResponse(err)
+		}
+
+		return response{CGroupStats: stats}
+	default:
+		return errorResponse(fmt.Errorf("broker: unknown operation %q", req.Op))
+	}
+}
+
+// streamExits sends the exit events which p may see until the connection or
+// the exit stream fails.
+func (s *Server) streamExits(c *net.UnixConn, enc *json.Encoder, p Peer) error {
+	select {
+	case s.streams <- struct{}{}:
+		defer func() { <-s.streams }()
+	default:
+		return enc.Encode(errorResponse(errors.New("broker: too many exit streams")))
+	}
+
+	l, err := s.listen()
+	if err != nil {
+		return enc.Encode(errorResponse(err))
+	}
+	defer l.Close()
+
+	// The client sends nothing more, so a read only completes when the
+	// connection is closed.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		_, _ = c.Read(make([]byte, 1))
+	}()
+
+	for {
+		select {
+		case <-closed:
+			return nil
+		case e, ok := <-l.Exits():
+			if !ok {
+				err := l.Err()
+				if err == nil {
+					err = errors.New("broker: exit stream closed")
+				}
+
+				return enc.Encode(errorResponse(err))
+			}
+
+			if !s.allowTask(p, e.Stats) {
+				continue
+			}
+
+			if err := enc.Encode(response{Exit: &exit{
+				PID:       e.PID,
+				Stats:     e.Stats,
+				TGID:      e.TGID,
+				TGIDStats: e.TGIDStats,
+				Time:      e.Time,
+			}}); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package broker
+
+import (
+	"testing"
+
+	"github.com/mdlayher/taskstats"
+)
+
+func TestDefaultAllowTask(t *testing.T) {
+	tests := []struct {
+		name string
+		p    Peer
+		s    *taskstats.Stats
+		ok   bool
+	}{
+		{
+			name: "superuser",
+			p:    Peer{PID: 1, UID: 0},
+			s:    &taskstats.Stats{PID: 2, TGID: 2, UID: 1000},
+			ok:   true,
+		},
+		{
+			name: "own thread group",
+			p:    Peer{PID: 1, UID: 1000},
+			s:    &taskstats.Stats{PID: 1, TGID: 1, UID: 0},
+			ok:   true,
+		},
+		{
+			name: "own thread",
+			p:    Peer{PID: 1, UID: 1000},
+			s:    &taskstats.Stats{PID: 2, TGID: 1, UID: 0},
+			ok:   true,
+		},
+		{
+			name: "same user",
+			p:    Peer{PID: 1, UID: 1000},
+			s:    &taskstats.Stats{PID: 2, TGID: 2, UID: 1000},
+			ok:   true,
+		},
+		{
+			name: "other user",
+			p:    Peer{PID: 1, UID: 1000},
+			s:    &taskstats.Stats{PID: 2, TGID: 2, UID: 1001},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DefaultAllowTask(tt.p, tt.s); got != tt.ok {
+				t.Fatalf("unexpected result: %v, want: %v", got, tt.ok)
+			}
+		})
+	}
+}
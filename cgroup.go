@@ -0,0 +1,285 @@
+package taskstats
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// A CGroupMode describes how cgroup hierarchies are mounted on a system.
+type CGroupMode int
+
+// Possible CGroupMode values.
+const (
+	// CGroupModeUnknown indicates that no cgroup hierarchies are mounted.
+	CGroupModeUnknown CGroupMode = iota
+
+	// CGroupModeLegacy indicates that only cgroup v1 hierarchies are
+	// mounted.
+	CGroupModeLegacy
+
+	// CGroupModeHybrid indicates that cgroup v1 hierarchies are mounted
+	// alongside the cgroup v2 unified hierarchy, typically at
+	// /sys/fs/cgroup/unified.
+	CGroupModeHybrid
+
+	// CGroupModeUnified indicates that only the cgroup v2 unified hierarchy
+	// is mounted.
+	CGroupModeUnified
+)
+
+// String returns the string representation of a CGroupMode.
+func (m CGroupMode) String() string {
+	switch m {
+	case CGroupModeUnknown:
+		return "unknown"
+	case CGroupModeLegacy:
+		return "legacy"
+	case CGroupModeHybrid:
+		return "hybrid"
+	case CGroupModeUnified:
+		return "unified"
+	default:
+		return "CGroupMode(" + strconv.Itoa(int(m)) + ")"
+	}
+}
+
+// DetectCGroupMode reports how cgroup hierarchies are mounted in the mount
+// namespace of the current process.
+func DetectCGroupMode() (CGroupMode, error) {
+	return detectCGroupMode()
+}
+
+// OpenCGroupDir opens the cgroup directory at path, which must be beneath the
+// directory root, such as "/sys/fs/cgroup". Each component of path is opened
+// without following symlinks, so the directory cannot be outside of root, and
+// it must be in a cgroup filesystem. It is intended for paths supplied by
+// untrusted clients, whose statistics can then be retrieved using
+// Client.CGroupStatsFile.
+func OpenCGroupDir(root, path string) (*os.File, error) {
+	return openCGroupDir(root, path)
+}
+
+// A CGroupTree is a cgroup and all of its descendants, each with its own
+// statistics.
+type CGroupTree struct {
+	// Path is the cgroup directory which was queried.
+	Path string
+
+	// Stats contains the statistics for tasks which are members of this
+	// cgroup itself, excluding tasks in descendant cgroups.
+	Stats *CGroupStats
+
+	// Children contains the child cgroups of this cgroup, ordered by path.
+	Children []*CGroupTree
+}
+
+// Total returns the combined statistics of the cgroup and all of its
+// descendants.
+func (t *CGroupTree) Total() *CGroupStats {
+	total := *t.Stats
+	for _, c := range t.Children {
+		total.add(c.Total())
+	}
+
+	return &total
+}
+
+// CGroupTaskStats retrieves the combined statistics of every task in the
+// cgroup directory specified by path and its descendants, providing
+// per-cgroup CPU, block I/O, swap-in, and thrashing delay accounting which the
+// kernel does not report directly.
+//
+// The statistics of each process listed in cgroup.procs are retrieved by
+// TGID. For a cgroup v2 threaded cgroup, the statistics of each thread listed
+// in cgroup.threads are retrieved by PID instead. Each task is counted once,
+// even if it is listed by several cgroups. Only tasks which are running
+// contribute to the result, as the kernel does not retain the usage of exited
+// tasks per cgroup. The identifiers of the result are zero.
+func (c *Client) CGroupTaskStats(path string) (*Stats, error) {
+	var total Stats
+	err := walkCGroupMembers(path, func(id int, thread bool) error {
+		query := c.TGID
+		if thread {
+			query = c.PID
+		}
+
+		stats, err := query(id)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			// Exited since the cgroup was read.
+			return nil
+		case err != nil:
+			return err
+		}
+
+		total.add(stats)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &total, nil
+}
+
+// walkCGroups builds a CGroupTree rooted at the cgroup directory root,
+// querying each cgroup using query. Cgroups which are removed during the walk
+// are omitted.
+func walkCGroups(root string, query func(path string) (*CGroupStats, error)) (*CGroupTree, error) {
+	stats, err := query(root)
+	if err != nil {
+		return nil, err
+	}
+
+	des, err := os.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &CGroupTree{
+		Path:  root,
+		Stats: stats,
+	}
+
+	for _, de := range des {
+		// Child cgroups are the only directories within a cgroup.
+		if !de.IsDir() {
+			continue
+		}
+
+		c, err := walkCGroups(filepath.Join(root, de.Name()), query)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// Removed since its parent was read.
+				continue
+			}
+
+			return nil, err
+		}
+
+		t.Children = append(t.Children, c)
+	}
+
+	return t, nil
+}
+
+// walkCGroupMembers calls fn for each member of the cgroup directory root and
+// its descendants. Each ID is passed to fn once, although in cgroup v1 the
+// threads of a process may be spread across several cgroups, each of which
+// lists the process, and a process may move between cgroups during the walk.
+//
+// If root is a cgroup v2 threaded cgroup, fn is called with the ID of each
+// thread listed in cgroup.threads, and thread set to true. Otherwise, fn is
+// called with the TGID of each process listed in cgroup.procs. The
+// cgroup.procs file of a threaded domain cgroup lists every process with
+// threads in its threaded subtree, so threaded descendants are skipped.
+func walkCGroupMembers(root string, fn func(id int, thread bool) error) error {
+	rootThreaded, err := isThreadedCGroup(root)
+	if err != nil {
+		return err
+	}
+
+	seen := make(map[int]struct{})
+
+	return filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) && path != root {
+				// Cgroup removed during the walk.
+				return nil
+			}
+
+			return err
+		}
+
+		if !d.IsDir() {
+			return nil
+		}
+
+		file := "cgroup.procs"
+		if rootThreaded {
+			file = "cgroup.threads"
+		} else if path != root {
+			threaded, err := isThreadedCGroup(path)
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					return filepath.SkipDir
+				}
+
+				return err
+			}
+
+			if threaded {
+				return filepath.SkipDir
+			}
+		}
+
+		ids, err := readCGroupIDs(filepath.Join(path, file))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) && path != root {
+				return nil
+			}
+
+			return err
+		}
+
+		for _, id := range ids {
+			if _, ok := seen[id]; ok {
+				continue
+			}
+			seen[id] = struct{}{}
+
+			if err := fn(id, rootThreaded); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// isThreadedCGroup reports whether dir is a cgroup v2 threaded cgroup.
+func isThreadedCGroup(dir string) (bool, error) {
+	b, err := os.ReadFile(filepath.Join(dir, "cgroup.type"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// Only cgroup v2 non-root cgroups have a type, so check that the
+			// cgroup itself exists.
+			if _, err := os.Stat(dir); err != nil {
+				return false, err
+			}
+
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return strings.TrimSpace(string(b)) == "threaded", nil
+}
+
+// readCGroupIDs reads the newline-separated IDs from a cgroup.procs or
+// cgroup.threads file.
+func readCGroupIDs(file string) ([]int, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for s.Scan() {
+		id, err := strconv.Atoi(strings.TrimSpace(s.Text()))
+		if err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, s.Err()
+}
@@ -0,0 +1,351 @@
+//go:build linux
+// +build linux
+
+package taskstats
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+)
+
+// fileIDKernfs is the file handle type used by kernfs, which backs cgroupfs.
+const fileIDKernfs = 0xfe
+
+// A cgroupMount is a cgroup hierarchy mount parsed from mountinfo.
+type cgroupMount struct {
+	// Point is where the hierarchy is mounted, and Root is the cgroup which
+	// appears at Point.
+	Point, Root string
+
+	// V2 reports whether this is the cgroup v2 unified hierarchy.
+	V2 bool
+
+	// Options contains the superblock options of the mount, which include
+	// the controllers bound to a cgroup v1 hierarchy.
+	Options []string
+}
+
+// has reports whether the mount has the superblock option opt.
+func (m cgroupMount) has(opt string) bool {
+	for _, o := range m.Options {
+		if o == opt {
+			return true
+		}
+	}
+
+	return false
+}
+
+// detectCGroupMode detects the cgroup mode using the mounts of the current
+// process.
+func detectCGroupMode() (CGroupMode, error) {
+	mounts, err := readCGroupMounts()
+	if err != nil {
+		return CGroupModeUnknown, err
+	}
+
+	return cgroupModeOf(mounts), nil
+}
+
+// cgroupModeOf determines the cgroup mode from a set of cgroup mounts.
+func cgroupModeOf(mounts []cgroupMount) CGroupMode {
+	var v1, v2 bool
+	for _, m := range mounts {
+		if m.V2 {
+			v2 = true
+		} else {
+			v1 = true
+		}
+	}
+
+	switch {
+	case v1 && v2:
+		return CGroupModeHybrid
+	case v1:
+		return CGroupModeLegacy
+	case v2:
+		return CGroupModeUnified
+	default:
+		return CGroupModeUnknown
+	}
+}
+
+// readCGroupMounts reads the cgroup mounts of the current process.
+func readCGroupMounts() ([]cgroupMount, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseCGroupMounts(f)
+}
+
+// parseCGroupMounts parses cgroup mounts from mountinfo in r.
+func parseCGroupMounts(r io.Reader) ([]cgroupMount, error) {
+	var mounts []cgroupMount
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		// Optional fields precede a "-" separator, followed by the
+		// filesystem type, mount source, and superblock options.
+		fields := strings.Fields(s.Text())
+
+		sep := -1
+		for i, f := range fields {
+			if f == "-" {
+				sep = i
+				break
+			}
+		}
+
+		if sep < 5 || len(fields) < sep+4 {
+			return nil, fmt.Errorf("taskstats: malformed mountinfo line: %q", s.Text())
+		}
+
+		var v2 bool
+		switch fields[sep+1] {
+		case "cgroup":
+		case "cgroup2":
+			v2 = true
+		default:
+			continue
+		}
+
+		mounts = append(mounts, cgroupMount{
+			Point:   unescapeMountinfo(fields[4]),
+			Root:    unescapeMountinfo(fields[3]),
+			V2:      v2,
+			Options: strings.Split(fields[sep+3], ","),
+		})
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+
+	return mounts, nil
+}
+
+// unescapeMountinfo replaces the octal escape sequences used by mountinfo
+// for whitespace and backslashes.
+func unescapeMountinfo(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				sb.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+
+		sb.WriteByte(s[i])
+	}
+
+	return sb.String()
+}
+
+// resolveCGroup resolves path to a directory which can be passed to the
+// kernel's cgroupstats interface.
+//
+// The kernel only accepts cgroup v1 directories. Paths outside the cgroup v2
+// hierarchy are returned unchanged. On hybrid systems, a cgroup v2 path is
+// mapped to the same cgroup in a cgroup v1 hierarchy, preferring systemd's
+// named hierarchy, which mirrors the unified hierarchy, followed by the cpu
+// controller. A cgroup v2 path which does not exist is reported as such. isDir
+// reports whether a directory exists.
+func resolveCGroup(path string, mounts []cgroupMount, isDir func(string) bool) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	// Find the most specific mount containing path.
+	var (
+		mount *cgroupMount
+		rel   string
+	)
+
+	for i, m := range mounts {
+		r, err := filepath.Rel(m.Point, abs)
+		if err != nil || r == ".." || strings.HasPrefix(r, "../") {
+			continue
+		}
+
+		if mount == nil || len(m.Point) > len(mount.Point) {
+			mount, rel = &mounts[i], r
+		}
+	}
+
+	if mount == nil || !mount.V2 {
+		return path, nil
+	}
+
+	// Report a missing cgroup as such, rather than as unsupported.
+	if !isDir(abs) {
+		return "", &os.PathError{Op: "stat", Path: path, Err: os.ErrNotExist}
+	}
+
+	cgroup := filepath.Join(mount.Root, rel)
+
+	var candidates []cgroupMount
+	for _, opt := range []string{"name=systemd", "cpu"} {
+		for _, m := range mounts {
+			if !m.V2 && m.has(opt) {
+				candidates = append(candidates, m)
+			}
+		}
+	}
+
+	for _, m := range candidates {
+		r, err := filepath.Rel(m.Root, cgroup)
+		if err != nil || r == ".." || strings.HasPrefix(r, "../") {
+			continue
+		}
+
+		if dir := filepath.Join(m.Point, r); isDir(dir) {
+			return dir, nil
+		}
+	}
+
+	return "", fmt.Errorf("taskstats: cgroup %q is in the cgroup v2 hierarchy, which the kernel's cgroupstats interface does not support, and no equivalent cgroup v1 directory exists: %w",
+		path, errors.ErrUnsupported)
+}
+
+// isDir reports whether path is a directory.
+func isDir(path string) bool {
+	fi, err := os.Stat(path)
+	return err == nil && fi.IsDir()
+}
+
+// findCGroups returns the cgroup directories whose names satisfy match in the
+// cgroup v2 hierarchy and the cgroup v1 hierarchies for systemd and the cpu
+// controller. Descendants of matching directories are not searched.
+func findCGroups(match func(name string) bool) ([]string, error) {
+	mounts, err := readCGroupMounts()
+	if err != nil {
+		return nil, err
+	}
+
+	var found []string
+	for _, m := range mounts {
+		if !m.V2 && !m.has("name=systemd") && !m.has("cpu") {
+			continue
+		}
+
+		err := filepath.WalkDir(m.Point, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) && path != m.Point {
+					// Cgroup removed during the walk.
+					return nil
+				}
+
+				return err
+			}
+
+			if !d.IsDir() || path == m.Point || !match(d.Name()) {
+				return nil
+			}
+
+			found = append(found, path)
+			return filepath.SkipDir
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(found) == 0 {
+		return nil, os.ErrNotExist
+	}
+
+	return found, nil
+}
+
+// openCGroupID opens the cgroup with ID id in the hierarchy mounted at mount.
+func openCGroupID(mount string, id uint64) (*os.File, error) {
+	const flags = unix.O_RDONLY | unix.O_DIRECTORY | unix.O_CLOEXEC
+
+	mfd, err := unix.Open(mount, flags, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: mount, Err: err}
+	}
+	defer unix.Close(mfd)
+
+	// A kernfs file handle is the node's 64-bit ID in native byte order.
+	b := make([]byte, 8)
+	binary.NativeEndian.PutUint64(b, id)
+
+	fd, err := unix.OpenByHandleAt(mfd, unix.NewFileHandle(fileIDKernfs, b), flags)
+	if err != nil {
+		if errors.Is(err, unix.ESTALE) {
+			// No cgroup with this ID.
+			return nil, os.ErrNotExist
+		}
+
+		return nil, os.NewSyscallError("open_by_handle_at", err)
+	}
+
+	return os.NewFile(uintptr(fd), "cgroup ID "+strconv.FormatUint(id, 10)), nil
+}
+
+// filePath returns the current path of the open file f. A file which has
+// been removed has a path ending in " (deleted)".
+func filePath(f *os.File) (string, error) {
+	path, err := os.Readlink("/proc/self/fd/" + strconv.Itoa(int(f.Fd())))
+	runtime.KeepAlive(f)
+	return path, err
+}
+
+// openCGroupDir implements OpenCGroupDir.
+func openCGroupDir(root, path string) (*os.File, error) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || !filepath.IsAbs(path) || rel == ".." || strings.HasPrefix(rel, "../") {
+		return nil, fmt.Errorf("taskstats: path %q is not beneath %q", path, root)
+	}
+
+	const flags = unix.O_RDONLY | unix.O_DIRECTORY | unix.O_NOFOLLOW | unix.O_CLOEXEC
+	fd, err := unix.Open(root, flags, 0)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: root, Err: err}
+	}
+
+	if rel != "." {
+		for _, name := range strings.Split(rel, "/") {
+			next, err := unix.Openat(fd, name, flags, 0)
+			_ = unix.Close(fd)
+			if err != nil {
+				return nil, &os.PathError{Op: "open", Path: path, Err: err}
+			}
+
+			fd = next
+		}
+	}
+
+	var st unix.Statfs_t
+	if err := unix.Fstatfs(fd, &st); err != nil {
+		_ = unix.Close(fd)
+		return nil, &os.PathError{Op: "fstatfs", Path: path, Err: err}
+	}
+	if st.Type != unix.CGROUP_SUPER_MAGIC && st.Type != unix.CGROUP2_SUPER_MAGIC {
+		_ = unix.Close(fd)
+		return nil, fmt.Errorf("taskstats: path %q is not in a cgroup filesystem", path)
+	}
+
+	return os.NewFile(uintptr(fd), path), nil
+}
@@ -0,0 +1,269 @@
+//go:build linux
+// +build linux
+
+package taskstats
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/genetlink/genltest"
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+	"golang.org/x/sys/unix"
+)
+
+const hybridMountinfo = `24 30 0:22 / /sys rw,nosuid,nodev,noexec,relatime shared:7 - sysfs sysfs rw
+32 24 0:28 / /sys/fs/cgroup ro,nosuid,nodev,noexec shared:9 - tmpfs tmpfs ro,mode=755
+33 32 0:29 / /sys/fs/cgroup/unified rw,nosuid,nodev,noexec,relatime shared:10 - cgroup2 cgroup2 rw,nsdelegate
+34 32 0:30 / /sys/fs/cgroup/systemd rw,nosuid,nodev,noexec,relatime shared:11 - cgroup cgroup rw,xattr,name=systemd
+35 32 0:31 / /sys/fs/cgroup/cpu,cpuacct rw,nosuid,nodev,noexec,relatime shared:12 - cgroup cgroup rw,cpu,cpuacct
+36 32 0:32 /docker /sys/fs/cgroup/memory\040x rw,nosuid,nodev,noexec,relatime - cgroup cgroup rw,memory
+`
+
+func TestParseCGroupMounts(t *testing.T) {
+	mounts, err := parseCGroupMounts(strings.NewReader(hybridMountinfo))
+	if err != nil {
+		t.Fatalf("failed to parse mounts: %v", err)
+	}
+
+	want := []cgroupMount{
+		{
+			Point:   "/sys/fs/cgroup/unified",
+			Root:    "/",
+			V2:      true,
+			Options: []string{"rw", "nsdelegate"},
+		},
+		{
+			Point:   "/sys/fs/cgroup/systemd",
+			Root:    "/",
+			Options: []string{"rw", "xattr", "name=systemd"},
+		},
+		{
+			Point:   "/sys/fs/cgroup/cpu,cpuacct",
+			Root:    "/",
+			Options: []string{"rw", "cpu", "cpuacct"},
+		},
+		{
+			Point:   "/sys/fs/cgroup/memory x",
+			Root:    "/docker",
+			Options: []string{"rw", "memory"},
+		},
+	}
+
+	if diff := cmp.Diff(want, mounts); diff != "" {
+		t.Fatalf("unexpected mounts (-want +got):\n%s", diff)
+	}
+
+	if _, err := parseCGroupMounts(strings.NewReader("1 2 3\n")); err == nil {
+		t.Fatal("an error was expected, but none occurred")
+	}
+}
+
+func TestCGroupModeOf(t *testing.T) {
+	v1 := cgroupMount{Point: "/sys/fs/cgroup/cpu"}
+	v2 := cgroupMount{Point: "/sys/fs/cgroup", V2: true}
+
+	tests := []struct {
+		name   string
+		mounts []cgroupMount
+		mode   CGroupMode
+	}{
+		{
+			name: "unknown",
+			mode: CGroupModeUnknown,
+		},
+		{
+			name:   "legacy",
+			mounts: []cgroupMount{v1},
+			mode:   CGroupModeLegacy,
+		},
+		{
+			name:   "hybrid",
+			mounts: []cgroupMount{v1, v2},
+			mode:   CGroupModeHybrid,
+		},
+		{
+			name:   "unified",
+			mounts: []cgroupMount{v2},
+			mode:   CGroupModeUnified,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.mode, cgroupModeOf(tt.mounts)); diff != "" {
+				t.Fatalf("unexpected cgroup mode (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestResolveCGroup(t *testing.T) {
+	hybrid, err := parseCGroupMounts(strings.NewReader(hybridMountinfo))
+	if err != nil {
+		t.Fatalf("failed to parse mounts: %v", err)
+	}
+
+	unified := []cgroupMount{{
+		Point:   "/sys/fs/cgroup",
+		Root:    "/",
+		V2:      true,
+		Options: []string{"rw"},
+	}}
+
+	tests := []struct {
+		name     string
+		mounts   []cgroupMount
+		dirs     []string
+		path     string
+		want     string
+		ok       bool
+		notExist bool
+	}{
+		{
+			name:   "not a cgroup",
+			mounts: hybrid,
+			path:   "/tmp/foo",
+			want:   "/tmp/foo",
+			ok:     true,
+		},
+		{
+			name:   "v1 controller",
+			mounts: hybrid,
+			path:   "/sys/fs/cgroup/cpu,cpuacct/docker",
+			want:   "/sys/fs/cgroup/cpu,cpuacct/docker",
+			ok:     true,
+		},
+		{
+			name:   "v2 to systemd",
+			mounts: hybrid,
+			dirs: []string{
+				"/sys/fs/cgroup/unified/system.slice",
+				"/sys/fs/cgroup/systemd/system.slice",
+				"/sys/fs/cgroup/cpu,cpuacct/system.slice",
+			},
+			path: "/sys/fs/cgroup/unified/system.slice/",
+			want: "/sys/fs/cgroup/systemd/system.slice",
+			ok:   true,
+		},
+		{
+			name:   "v2 to cpu",
+			mounts: hybrid,
+			dirs:   []string{"/sys/fs/cgroup/unified/docker/abc", "/sys/fs/cgroup/cpu,cpuacct/docker/abc"},
+			path:   "/sys/fs/cgroup/unified/docker/abc",
+			want:   "/sys/fs/cgroup/cpu,cpuacct/docker/abc",
+			ok:     true,
+		},
+		{
+			name:   "v2 without v1 equivalent",
+			mounts: hybrid,
+			dirs:   []string{"/sys/fs/cgroup/unified/docker/abc"},
+			path:   "/sys/fs/cgroup/unified/docker/abc",
+		},
+		{
+			name:     "v2 not exist",
+			mounts:   hybrid,
+			path:     "/sys/fs/cgroup/unified/docker/abc",
+			notExist: true,
+		},
+		{
+			name:   "unified",
+			mounts: unified,
+			dirs:   []string{"/sys/fs/cgroup/system.slice"},
+			path:   "/sys/fs/cgroup/system.slice",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			isDir := func(dir string) bool {
+				for _, d := range tt.dirs {
+					if d == dir {
+						return true
+					}
+				}
+
+				return false
+			}
+
+			got, err := resolveCGroup(tt.path, tt.mounts, isDir)
+			if tt.notExist {
+				if !errors.Is(err, os.ErrNotExist) {
+					t.Fatalf("expected not exist, but got: %v", err)
+				}
+
+				return
+			}
+			if !tt.ok {
+				if !errors.Is(err, errors.ErrUnsupported) {
+					t.Fatalf("expected unsupported, but got: %v", err)
+				}
+
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to resolve cgroup: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Fatalf("unexpected cgroup path (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestLinuxClientCGroupStatsRejected(t *testing.T) {
+	f, done := tempFile(t)
+	defer done()
+
+	c := testClient(t, func(_ genetlink.Message, _ netlink.Message) ([]genetlink.Message, error) {
+		return nil, genltest.Error(int(unix.EINVAL))
+	})
+	defer c.Close()
+
+	_, err := c.CGroupStats(f)
+	if !errors.Is(err, unix.EINVAL) {
+		t.Fatalf("expected EINVAL, but got: %v", err)
+	}
+
+	if !strings.Contains(err.Error(), "cgroup v1") {
+		t.Fatalf("expected error to explain cgroup v1 requirement, but got: %v", err)
+	}
+}
+
+func TestLinuxClientCGroupStatsFD(t *testing.T) {
+	const fd = 42
+
+	c := testClient(t, genltest.CheckRequest(
+		familyID,
+		unix.CGROUPSTATS_CMD_GET,
+		netlink.Request,
+		func(gm genetlink.Message, _ netlink.Message) ([]genetlink.Message, error) {
+			attrs, err := netlink.UnmarshalAttributes(gm.Data)
+			if err != nil {
+				t.Fatalf("failed to unmarshal netlink attributes: %v", err)
+			}
+
+			if diff := cmp.Diff(uint32(fd), nlenc.Uint32(attrs[0].Data)); diff != "" {
+				t.Fatalf("unexpected file descriptor (-want +got):\n%s", diff)
+			}
+
+			return nil, genltest.Error(int(unix.EINVAL))
+		},
+	))
+	defer c.Close()
+
+	_, err := c.CGroupStatsFD(fd)
+	if !errors.Is(err, unix.EINVAL) {
+		t.Fatalf("expected EINVAL, but got: %v", err)
+	}
+
+	if !strings.Contains(err.Error(), "fd 42") {
+		t.Fatalf("expected error to describe file descriptor, but got: %v", err)
+	}
+}
@@ -0,0 +1,21 @@
+//go:build !linux
+// +build !linux
+
+package taskstats
+
+import "os"
+
+// detectCGroupMode always returns an error.
+func detectCGroupMode() (CGroupMode, error) {
+	return CGroupModeUnknown, errUnimplemented
+}
+
+// openCGroupDir always returns an error.
+func openCGroupDir(_, _ string) (*os.File, error) {
+	return nil, errUnimplemented
+}
+
+// findCGroups always returns an error.
+func findCGroups(_ func(name string) bool) ([]string, error) {
+	return nil, errUnimplemented
+}
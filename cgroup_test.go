@@ -0,0 +1,166 @@
+package taskstats
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWalkCGroups(t *testing.T) {
+	root := t.TempDir()
+	for _, dir := range []string{"a/c", "b"} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0o755); err != nil {
+			t.Fatalf("failed to create cgroup directory: %v", err)
+		}
+	}
+
+	// Interface files must not be treated as cgroups.
+	if err := os.WriteFile(filepath.Join(root, "cgroup.procs"), nil, 0o644); err != nil {
+		t.Fatalf("failed to create cgroup file: %v", err)
+	}
+
+	query := func(path string) (*CGroupStats, error) {
+		switch rel, _ := filepath.Rel(root, path); rel {
+		case ".":
+			return &CGroupStats{Sleeping: 1}, nil
+		case "a":
+			return &CGroupStats{Running: 2}, nil
+		case "a/c":
+			return &CGroupStats{Sleeping: 3, IOWait: 1}, nil
+		default:
+			// Removed during the walk.
+			return nil, os.ErrNotExist
+		}
+	}
+
+	tree, err := walkCGroups(root, query)
+	if err != nil {
+		t.Fatalf("failed to walk cgroups: %v", err)
+	}
+
+	want := &CGroupTree{
+		Path:  root,
+		Stats: &CGroupStats{Sleeping: 1},
+		Children: []*CGroupTree{{
+			Path:  filepath.Join(root, "a"),
+			Stats: &CGroupStats{Running: 2},
+			Children: []*CGroupTree{{
+				Path:  filepath.Join(root, "a/c"),
+				Stats: &CGroupStats{Sleeping: 3, IOWait: 1},
+			}},
+		}},
+	}
+
+	if diff := cmp.Diff(want, tree); diff != "" {
+		t.Fatalf("unexpected cgroup tree (-want +got):\n%s", diff)
+	}
+
+	total := &CGroupStats{Sleeping: 4, Running: 2, IOWait: 1}
+	if diff := cmp.Diff(total, tree.Total()); diff != "" {
+		t.Fatalf("unexpected total stats (-want +got):\n%s", diff)
+	}
+}
+
+func TestWalkCGroupsRootNotExist(t *testing.T) {
+	_, err := walkCGroups(filepath.Join(t.TempDir(), "gone"), func(_ string) (*CGroupStats, error) {
+		return nil, os.ErrNotExist
+	})
+	if !os.IsNotExist(err) {
+		t.Fatalf("expected is not exist, but got: %v", err)
+	}
+}
+
+func TestWalkCGroupMembers(t *testing.T) {
+	root := t.TempDir()
+
+	files := map[string]string{
+		"cgroup.procs":             "1\n",
+		"a/cgroup.procs":           "2\n3\n",
+		"a/x/cgroup.procs":         "3\n8\n",
+		"a/x/y/cgroup.procs":       "2\n8\n9\n",
+		"b/cgroup.procs":           "",
+		"d/cgroup.type":            "domain threaded\n",
+		"d/cgroup.procs":           "4\n",
+		"d/t/cgroup.type":          "threaded\n",
+		"d/t/cgroup.threads":       "5\n6\n",
+		"d/t/child/cgroup.type":    "threaded\n",
+		"d/t/child/cgroup.threads": "7\n",
+	}
+
+	for file, contents := range files {
+		path := filepath.Join(root, file)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatalf("failed to create cgroup directory: %v", err)
+		}
+
+		if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+			t.Fatalf("failed to create cgroup file: %v", err)
+		}
+	}
+
+	// Directory without cgroup.procs, as if removed during the walk.
+	if err := os.Mkdir(filepath.Join(root, "c"), 0o755); err != nil {
+		t.Fatalf("failed to create cgroup directory: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		root    string
+		ids     []int
+		threads bool
+	}{
+		{
+			name: "domain",
+			root: root,
+			ids:  []int{1, 2, 3, 4, 8, 9},
+		},
+		{
+			name: "nested",
+			root: filepath.Join(root, "a/x"),
+			ids:  []int{2, 3, 8, 9},
+		},
+		{
+			name: "threaded domain",
+			root: filepath.Join(root, "d"),
+			ids:  []int{4},
+		},
+		{
+			name:    "threaded",
+			root:    filepath.Join(root, "d/t"),
+			ids:     []int{5, 6, 7},
+			threads: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ids []int
+			err := walkCGroupMembers(tt.root, func(id int, thread bool) error {
+				if thread != tt.threads {
+					t.Fatalf("unexpected thread member: %d", id)
+				}
+
+				ids = append(ids, id)
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("failed to walk cgroup members: %v", err)
+			}
+
+			sort.Ints(ids)
+			if diff := cmp.Diff(tt.ids, ids); diff != "" {
+				t.Fatalf("unexpected member IDs (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("not exist", func(t *testing.T) {
+		err := walkCGroupMembers(filepath.Join(root, "c"), func(int, bool) error { return nil })
+		if !os.IsNotExist(err) {
+			t.Fatalf("expected is not exist, but got: %v", err)
+		}
+	})
+}
@@ -9,8 +9,10 @@
 package taskstats
 
 import (
+	"errors"
 	"io"
 	"os"
+	"runtime"
 )
 
 // A Client provides access to Linux taskstats information.
@@ -33,18 +35,101 @@ func New() (*Client, error) {
 }
 
 // CGroupStats retrieves cgroup statistics for the cgroup specified by path.
-// Path should be a CPU cgroup path found in sysfs, such as:
+// Path should be a cgroup directory found in sysfs, such as:
 //   - /sys/fs/cgroup/cpu
 //   - /sys/fs/cgroup/cpu/docker
 //   - /sys/fs/cgroup/cpu/docker/(hexadecimal identifier)
+//
+// The kernel only supports cgroup v1 hierarchies. On systems using the hybrid
+// layout, a cgroup v2 directory such as /sys/fs/cgroup/unified/system.slice is
+// resolved to the same cgroup in a cgroup v1 hierarchy, preferring systemd's
+// named hierarchy followed by the cpu controller. On systems using only the
+// cgroup v2 unified hierarchy, cgroup v2 directories cannot be resolved and
+// CGroupStats returns an error wrapping errors.ErrUnsupported. See
+// DetectCGroupMode.
 func (c *Client) CGroupStats(path string) (*CGroupStats, error) {
 	return c.c.CGroupStats(path)
 }
 
+// CGroupStatsFile retrieves cgroup statistics for the cgroup directory opened
+// as f. Holding a cgroup directory open allows long-running callers to query
+// the same cgroup repeatedly, even if another cgroup is later created at the
+// same path.
+//
+// Unlike CGroupStats, no path resolution is performed, so f must be a
+// directory in a cgroup v1 hierarchy.
+func (c *Client) CGroupStatsFile(f *os.File) (*CGroupStats, error) {
+	stats, err := c.c.CGroupStatsFD(int(f.Fd()))
+	runtime.KeepAlive(f)
+	return stats, err
+}
+
+// CGroupStatsFD is like CGroupStatsFile, but accepts a file descriptor for an
+// open cgroup directory.
+func (c *Client) CGroupStatsFD(fd int) (*CGroupStats, error) {
+	return c.c.CGroupStatsFD(fd)
+}
+
+// CGroupStatsID retrieves cgroup statistics for the cgroup with the 64-bit
+// cgroup ID id in the cgroup v2 unified hierarchy, such as the IDs reported
+// by BPF programs and other tools. The cgroup is opened by its ID using
+// open_by_handle_at(2), which requires CAP_DAC_READ_SEARCH, and is then
+// resolved as described by CGroupStats.
+func (c *Client) CGroupStatsID(id uint64) (*CGroupStats, error) {
+	return c.c.CGroupStatsID(id)
+}
+
+// CGroupTree walks the cgroup hierarchy rooted at the cgroup specified by
+// path, and retrieves cgroup statistics for every cgroup found. Path is
+// resolved as described by CGroupStats.
+//
+// Cgroups which are removed while the hierarchy is walked are omitted from
+// the result. The statistics for each cgroup only count its own member tasks;
+// use CGroupTree.Total to include descendant cgroups.
+func (c *Client) CGroupTree(path string) (*CGroupTree, error) {
+	return c.c.CGroupTree(path)
+}
+
 // Self is a convenience method for retrieving statistics about the current
-// process.
+// process, as described by Process.
 func (c *Client) Self() (*Stats, error) {
-	return c.c.TGID(os.Getpid())
+	return c.Process(os.Getpid())
+}
+
+// Thread retrieves statistics about the OS thread running the calling
+// goroutine, identified by its thread ID.
+//
+// The Go runtime moves goroutines between OS threads, so the calling
+// goroutine should be locked to its thread using runtime.LockOSThread for the
+// result to be meaningful.
+func (c *Client) Thread() (*Stats, error) {
+	return c.c.PID(gettid())
+}
+
+// Measure locks the calling goroutine to its OS thread, calls fn, and returns
+// the change in the thread's statistics while fn ran, such as the CPU and
+// block I/O delay incurred by fn. ElapsedTime is set to the time elapsed
+// between the samples taken before and after fn.
+//
+// Only work performed by fn on the calling goroutine is measured. Work which
+// fn hands off to other goroutines runs on other threads and is not included.
+func (c *Client) Measure(fn func()) (*Stats, error) {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	before, err := c.Thread()
+	if err != nil {
+		return nil, err
+	}
+
+	fn()
+
+	after, err := c.Thread()
+	if err != nil {
+		return nil, err
+	}
+
+	return after.sub(before), nil
 }
 
 // PID retrieves statistics about a process, identified by its PID.
@@ -53,10 +138,75 @@ func (c *Client) PID(pid int) (*Stats, error) {
 }
 
 // TGID retrieves statistics about a thread group, identified by its TGID.
+//
+// The kernel's statistics for a thread group only account for the delays of
+// its threads, including threads which have exited, and their ElapsedTime
+// summed over the threads. Use Process for the statistics of a whole process.
 func (c *Client) TGID(tgid int) (*Stats, error) {
 	return c.c.TGID(tgid)
 }
 
+// Process retrieves statistics about a process, identified by its TGID.
+//
+// The thread group statistics reported by TGID are combined with the
+// statistics of each thread of the process. The identifiers, begin time and
+// memory high-water marks are those of the thread group leader, and
+// ElapsedTime is the time elapsed since it started. The CPU times, page
+// faults and I/O are summed over the threads, and omit those of threads which
+// have already exited, which the kernel does not retain.
+func (c *Client) Process(tgid int) (*Stats, error) {
+	stats, err := c.c.TGID(tgid)
+	if err != nil {
+		return nil, err
+	}
+
+	tids, err := procThreads(tgid)
+	if err != nil {
+		return nil, err
+	}
+
+	return processStats(tgid, stats, tids, c.c.PID)
+}
+
+// processStats combines the thread group statistics group of the process
+// identified by tgid with the statistics of its threads tids, queried using
+// pid.
+func processStats(tgid int, group *Stats, tids []int, pid func(pid int) (*Stats, error)) (*Stats, error) {
+	leader, err := pid(tgid)
+	if err != nil {
+		return nil, err
+	}
+
+	s := *group
+	s.PID, s.PPID, s.TGID = tgid, leader.PPID, tgid
+	s.UID, s.GID, s.Comm = leader.UID, leader.GID, leader.Comm
+	s.ExitCode, s.Flags = leader.ExitCode, leader.Flags
+	s.PeakRSS, s.PeakVirtualMemory = leader.PeakRSS, leader.PeakVirtualMemory
+	s.BeginTime = leader.BeginTime
+	s.ElapsedTime, s.GroupElapsedTime = leader.ElapsedTime, leader.ElapsedTime
+	s.addUsage(leader)
+
+	for _, tid := range tids {
+		if tid == tgid {
+			continue
+		}
+
+		t, err := pid(tid)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// Thread exited since the threads were listed.
+				continue
+			}
+
+			return nil, err
+		}
+
+		s.addUsage(t)
+	}
+
+	return &s, nil
+}
+
 // Close releases resources used by a Client.
 func (c *Client) Close() error {
 	return c.c.Close()
@@ -66,6 +216,9 @@ func (c *Client) Close() error {
 type osClient interface {
 	io.Closer
 	CGroupStats(path string) (*CGroupStats, error)
+	CGroupStatsFD(fd int) (*CGroupStats, error)
+	CGroupStatsID(id uint64) (*CGroupStats, error)
+	CGroupTree(path string) (*CGroupTree, error)
 	PID(pid int) (*Stats, error)
 	TGID(tgid int) (*Stats, error)
 }
@@ -4,8 +4,10 @@
 package taskstats
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"strconv"
 	"unsafe"
 
 	"github.com/mdlayher/genetlink"
@@ -15,7 +17,10 @@ import (
 )
 
 // Fixed structure sizes.
-const sizeofCGroupStats = int(unsafe.Sizeof(unix.CGroupStats{}))
+const (
+	sizeofCGroupStats = int(unsafe.Sizeof(unix.CGroupStats{}))
+	sizeofTaskstats   = int(unsafe.Sizeof(unix.Taskstats{}))
+)
 
 var _ osClient = &client{}
 
@@ -75,7 +80,7 @@ func (c *client) getStats(id int, cmdAttr, typeAggr uint16) (*Stats, error) {
 		Data: nlenc.Uint32Bytes(uint32(id)),
 	}}
 
-	msg, err := c.execute(unix.TASKSTATS_CMD_GET, attrs)
+	msg, err := c.execute(unix.TASKSTATS_CMD_GET, netlink.Request, attrs)
 	if err != nil {
 		return nil, err
 	}
@@ -85,6 +90,37 @@ func (c *client) getStats(id int, cmdAttr, typeAggr uint16) (*Stats, error) {
 
 // CGroupStats implements osClient.
 func (c *client) CGroupStats(path string) (*CGroupStats, error) {
+	mounts, err := readCGroupMounts()
+	if err != nil {
+		return nil, err
+	}
+
+	path, err = resolveCGroup(path, mounts, isDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.cgroupStats(path)
+}
+
+// CGroupTree implements osClient.
+func (c *client) CGroupTree(path string) (*CGroupTree, error) {
+	mounts, err := readCGroupMounts()
+	if err != nil {
+		return nil, err
+	}
+
+	// Resolve the root once, as its descendants share its hierarchy.
+	path, err = resolveCGroup(path, mounts, isDir)
+	if err != nil {
+		return nil, err
+	}
+
+	return walkCGroups(path, c.cgroupStats)
+}
+
+// cgroupStats retrieves cgroup statistics for an already resolved cgroup path.
+func (c *client) cgroupStats(path string) (*CGroupStats, error) {
 	// Open cgroup path so its file descriptor can be passed to taskstats.
 	f, err := os.Open(path)
 	if err != nil {
@@ -92,14 +128,82 @@ func (c *client) CGroupStats(path string) (*CGroupStats, error) {
 	}
 	defer f.Close()
 
+	return c.cgroupStatsFD(int(f.Fd()), strconv.Quote(path))
+}
+
+// CGroupStatsFD implements osClient.
+func (c *client) CGroupStatsFD(fd int) (*CGroupStats, error) {
+	return c.cgroupStatsFD(fd, "fd "+strconv.Itoa(fd))
+}
+
+// CGroupStatsID implements osClient.
+func (c *client) CGroupStatsID(id uint64) (*CGroupStats, error) {
+	mounts, err := readCGroupMounts()
+	if err != nil {
+		return nil, err
+	}
+
+	var unified *cgroupMount
+	for i, m := range mounts {
+		if m.V2 {
+			unified = &mounts[i]
+			break
+		}
+	}
+	if unified == nil {
+		return nil, fmt.Errorf("taskstats: cgroup v2 hierarchy is not mounted: %w", os.ErrNotExist)
+	}
+
+	f, err := openCGroupID(unified.Point, id)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	path, err := filePath(f)
+	if err != nil {
+		return nil, err
+	}
+
+	// The kernel rejects cgroup v2 directories, so resolve the cgroup's path
+	// to a cgroup v1 equivalent where possible.
+	v1Path, err := resolveCGroup(path, mounts, isDir)
+	if err != nil {
+		return nil, err
+	}
+
+	v1, err := os.Open(v1Path)
+	if err != nil {
+		return nil, err
+	}
+	defer v1.Close()
+
+	// Holding the cgroup open pins its path, so if it is still there, the
+	// cgroup v1 equivalent was not opened for another cgroup which replaced
+	// it after it was removed.
+	if now, err := filePath(f); err != nil || now != path {
+		return nil, os.ErrNotExist
+	}
+
+	return c.cgroupStatsFD(int(v1.Fd()), strconv.Quote(v1Path))
+}
+
+// cgroupStatsFD retrieves cgroup statistics for the cgroup directory opened as
+// fd, using name to describe the cgroup in errors.
+func (c *client) cgroupStatsFD(fd int, name string) (*CGroupStats, error) {
 	// Query taskstats for cgroup information using the file descriptor.
 	attrs := []netlink.Attribute{{
 		Type: unix.CGROUPSTATS_CMD_ATTR_FD,
-		Data: nlenc.Uint32Bytes(uint32(f.Fd())),
+		Data: nlenc.Uint32Bytes(uint32(fd)),
 	}}
 
-	msg, err := c.execute(unix.CGROUPSTATS_CMD_GET, attrs)
+	msg, err := c.execute(unix.CGROUPSTATS_CMD_GET, netlink.Request, attrs)
 	if err != nil {
+		if errors.Is(err, unix.EINVAL) {
+			// The kernel rejects anything but a cgroup v1 directory.
+			return nil, fmt.Errorf("taskstats: kernel rejected %s, which must be a directory in a cgroup v1 hierarchy: %w", name, err)
+		}
+
 		return nil, err
 	}
 
@@ -107,7 +211,7 @@ func (c *client) CGroupStats(path string) (*CGroupStats, error) {
 }
 
 // execute executes a single generic netlink command and returns its response.
-func (c *client) execute(cmd uint8, attrs []netlink.Attribute) (*genetlink.Message, error) {
+func (c *client) execute(cmd uint8, flags netlink.HeaderFlags, attrs []netlink.Attribute) (*genetlink.Message, error) {
 	b, err := netlink.MarshalAttributes(attrs)
 	if err != nil {
 		return nil, err
@@ -121,7 +225,7 @@ func (c *client) execute(cmd uint8, attrs []netlink.Attribute) (*genetlink.Messa
 		Data: b,
 	}
 
-	msgs, err := c.c.Execute(msg, c.family.ID, netlink.Request)
+	msgs, err := c.c.Execute(msg, c.family.ID, flags)
 	if err != nil {
 		// We don't want to expose netlink errors directly to callers, so unpack
 		// the error for use with os.IsPermission and similar.
@@ -193,12 +297,26 @@ func parseMessage(m genetlink.Message, typeAggr uint16) (*Stats, error) {
 				continue
 			}
 
-			// Assume the kernel returns a structure compatible with the
-			// taskstats struct and cast directly.
-			return parseStats(*(*unix.Taskstats)(unsafe.Pointer(&na.Data[0])))
+			return unmarshalStats(na.Data)
 		}
 	}
 
 	// No taskstats response found.
 	return nil, os.ErrNotExist
 }
+
+// unmarshalStats parses a Stats structure from a raw taskstats structure.
+func unmarshalStats(b []byte) (*Stats, error) {
+	// Older kernels return a shorter structure than unix.Taskstats, so copy
+	// the data into a zeroed structure rather than casting it in place, which
+	// would read beyond the end of b.
+	var ts unix.Taskstats
+	copy((*[sizeofTaskstats]byte)(unsafe.Pointer(&ts))[:], b)
+
+	return parseStats(ts)
+}
+
+// gettid returns the thread ID of the calling thread.
+func gettid() int {
+	return unix.Gettid()
+}
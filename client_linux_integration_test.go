@@ -4,10 +4,16 @@
 package taskstats_test
 
 import (
+	"encoding/binary"
+	"errors"
 	"os"
+	"os/exec"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/mdlayher/taskstats"
+	"golang.org/x/sys/unix"
 )
 
 func TestLinuxClientIntegration(t *testing.T) {
@@ -24,6 +30,54 @@ func TestLinuxClientIntegration(t *testing.T) {
 	t.Run("cgroup", func(t *testing.T) {
 		testCGroupStats(t, c)
 	})
+
+	t.Run("cgroup file", func(t *testing.T) {
+		testCGroupStatsFile(t, c)
+	})
+
+	t.Run("cgroup ID", func(t *testing.T) {
+		testCGroupStatsID(t, c)
+	})
+
+	t.Run("cgroup tree", func(t *testing.T) {
+		testCGroupTree(t, c)
+	})
+
+	t.Run("cgroup tasks", func(t *testing.T) {
+		testCGroupTaskStats(t, c)
+	})
+
+	t.Run("exits", func(t *testing.T) {
+		testExits(t)
+	})
+
+	t.Run("process tree", func(t *testing.T) {
+		testProcessTree(t, c)
+	})
+
+	t.Run("session", func(t *testing.T) {
+		testSession(t)
+	})
+
+	t.Run("run", func(t *testing.T) {
+		testRun(t)
+	})
+
+	t.Run("run multithreaded", func(t *testing.T) {
+		testRunMultithreaded(t)
+	})
+
+	t.Run("watch", func(t *testing.T) {
+		testWatch(t, c)
+	})
+
+	t.Run("measure", func(t *testing.T) {
+		testMeasure(t, c)
+	})
+
+	t.Run("collector", func(t *testing.T) {
+		testCollector(t, c)
+	})
 }
 
 func testSelfStats(t *testing.T, c *taskstats.Client) {
@@ -44,16 +98,368 @@ func testSelfStats(t *testing.T, c *taskstats.Client) {
 }
 
 func testCGroupStats(t *testing.T, c *taskstats.Client) {
+	mode, err := taskstats.DetectCGroupMode()
+	if err != nil {
+		t.Fatalf("failed to detect cgroup mode: %v", err)
+	}
+
+	// The kernel only accepts cgroup v1 hierarchies, so a v2 path can only be
+	// used when a v1 equivalent exists.
+	switch mode {
+	case taskstats.CGroupModeHybrid:
+		if _, err := c.CGroupStats("/sys/fs/cgroup/unified"); err != nil {
+			t.Fatalf("failed to retrieve cgroup v2 stats on hybrid system: %v", err)
+		}
+	case taskstats.CGroupModeUnified:
+		if _, err := c.CGroupStats("/sys/fs/cgroup"); !errors.Is(err, errors.ErrUnsupported) {
+			t.Fatalf("expected unsupported on unified system, but got: %v", err)
+		}
+	}
+
 	// TODO(mdlayher): try to verify these in some meaningful way, but for now,
 	// no error means the structure is valid, which works.
-	_, err := c.CGroupStats("/sys/fs/cgroup/cpu")
-	if err == nil {
-		return
+	if _, err := c.CGroupStats(cgroupV1CPU(t)); err != nil {
+		t.Fatalf("failed to retrieve cgroup stats: %v", err)
+	}
+}
+
+// cgroupV1CPU returns the mount point of the cgroup v1 cpu controller, or
+// skips the test if it is not mounted, as on systems using only cgroup v2.
+func cgroupV1CPU(t *testing.T) string {
+	t.Helper()
+
+	b, err := os.ReadFile("/proc/self/mountinfo")
+	if err != nil {
+		t.Fatalf("failed to read mountinfo: %v", err)
 	}
 
-	if os.IsNotExist(err) {
-		t.Skipf("did not find cgroup CPU stats: %v", err)
+	for _, line := range strings.Split(string(b), "\n") {
+		// The filesystem type and superblock options follow a "-" separator.
+		fields := strings.Fields(line)
+		for i, f := range fields {
+			if f != "-" || len(fields) < i+4 || fields[i+1] != "cgroup" {
+				continue
+			}
+
+			for _, opt := range strings.Split(fields[i+3], ",") {
+				if opt == "cpu" {
+					return fields[4]
+				}
+			}
+		}
+	}
+
+	t.Skip("cgroup v1 cpu controller is not mounted")
+	return ""
+}
+
+func testExits(t *testing.T) {
+	l, err := taskstats.ListenExits(&taskstats.ExitConfig{Shards: 2})
+	if err != nil {
+		if os.IsPermission(err) {
+			t.Skipf("taskstats requires elevated permission: %v", err)
+		}
+
+		t.Fatalf("failed to listen for exits: %v", err)
 	}
+	defer l.Close()
 
-	t.Fatalf("failed to retrieve cgroup stats: %v", err)
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("failed to run command: %v", err)
+	}
+
+	timer := time.NewTimer(5 * time.Second)
+	defer timer.Stop()
+
+	for {
+		select {
+		case e, ok := <-l.Exits():
+			if !ok {
+				t.Fatalf("exit listener stopped: %v", l.Err())
+			}
+
+			if e.PID != cmd.Process.Pid {
+				continue
+			}
+
+			if e.Stats.BeginTime.IsZero() {
+				t.Fatalf("unexpected zero begin time")
+			}
+
+			return
+		case <-timer.C:
+			t.Fatalf("timed out waiting for exit of PID %d", cmd.Process.Pid)
+		}
+	}
+}
+
+func testProcessTree(t *testing.T, c *taskstats.Client) {
+	cmd := exec.Command("sleep", "10")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("failed to start command: %v", err)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+
+	tree, err := c.ProcessTree(os.Getpid(), nil)
+	if err != nil {
+		if os.IsPermission(err) {
+			t.Skipf("taskstats requires elevated permission: %v", err)
+		}
+
+		t.Fatalf("failed to build process tree: %v", err)
+	}
+
+	for _, child := range tree.Children {
+		if child.TGID == cmd.Process.Pid {
+			return
+		}
+	}
+
+	t.Fatalf("child process %d not found in process tree", cmd.Process.Pid)
+}
+
+func testSession(t *testing.T) {
+	// The shell forks a child and waits for it.
+	cmd := exec.Command("sh", "-c", "sleep 0.2 & wait")
+	s, err := taskstats.StartSession(cmd, nil)
+	if err != nil {
+		if os.IsPermission(err) {
+			t.Skipf("taskstats requires elevated permission: %v", err)
+		}
+
+		t.Fatalf("failed to start session: %v", err)
+	}
+	defer s.Close()
+
+	sum, err := s.Wait()
+	if err != nil {
+		t.Fatalf("failed to wait for session: %v", err)
+	}
+
+	if sum.Processes < 2 {
+		t.Fatalf("expected at least 2 processes, but got: %d", sum.Processes)
+	}
+
+	// A short-lived child forks its own children, which exit before any of
+	// them can be discovered by a scan.
+	cmd = exec.Command("sh", "-c", "sh -c '/bin/true; /bin/true; :'; :")
+	s, err = taskstats.StartSession(cmd, nil)
+	if err != nil {
+		t.Fatalf("failed to start nested session: %v", err)
+	}
+	defer s.Close()
+
+	sum, err = s.Wait()
+	if err != nil {
+		t.Fatalf("failed to wait for nested session: %v", err)
+	}
+
+	if sum.Processes != 4 || sum.Missed != 0 {
+		t.Fatalf("unexpected processes: %d, missed: %d, want: 4, 0", sum.Processes, sum.Missed)
+	}
+}
+
+func testRun(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "exit 3")
+	stats, err := taskstats.Run(cmd)
+	if os.IsPermission(err) {
+		t.Skipf("taskstats requires elevated permission: %v", err)
+	}
+
+	var eerr *exec.ExitError
+	if !errors.As(err, &eerr) || eerr.ExitCode() != 3 {
+		t.Fatalf("expected exit code 3, but got: %v", err)
+	}
+
+	if stats.PID != cmd.Process.Pid {
+		t.Fatalf("unexpected PID: %d, want: %d", stats.PID, cmd.Process.Pid)
+	}
+}
+
+func testRunMultithreaded(t *testing.T) {
+	// The test binary runs as a multithreaded process whose thread group
+	// leader exits before its other threads; see TestMain.
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), "TASKSTATS_TEST_LEADER_EXITS_FIRST=1")
+
+	start := time.Now()
+	stats, err := taskstats.Run(cmd)
+	wall := time.Since(start)
+	if err != nil {
+		if os.IsPermission(err) {
+			t.Skipf("taskstats requires elevated permission: %v", err)
+		}
+
+		t.Fatalf("failed to run command: %v", err)
+	}
+
+	if stats.PID != cmd.Process.Pid {
+		t.Fatalf("unexpected PID: %d, want: %d", stats.PID, cmd.Process.Pid)
+	}
+
+	// Statistics for the whole process carry the flags of its last task,
+	// rather than those of the leader which exited first.
+	if stats.TGID != 0 && stats.Flags&taskstats.AccountingGroupExited == 0 {
+		t.Fatalf("expected statistics for the whole process, but got: %+v", stats)
+	}
+
+	if stats.GroupElapsedTime == 0 {
+		t.Skip("kernel does not report thread group elapsed time")
+	}
+
+	// The begin time and elapsed time are those of the process, rather than
+	// summed over its threads, and its threads' usage is included. Begin
+	// times are only accurate to the second.
+	if stats.BeginTime.Before(start.Add(-2*time.Second)) || stats.BeginTime.After(time.Now()) {
+		t.Fatalf("unexpected begin time: %v, started at: %v", stats.BeginTime, start)
+	}
+	// The last thread exits the process after sleeping for 100ms.
+	if stats.ElapsedTime < 100*time.Millisecond || stats.ElapsedTime > wall {
+		t.Fatalf("unexpected elapsed time: %v, wall time: %v", stats.ElapsedTime, wall)
+	}
+	if stats.MinorPageFaults == 0 {
+		t.Fatalf("expected page faults of the process's threads: %+v", stats)
+	}
+}
+
+func testWatch(t *testing.T, c *taskstats.Client) {
+	cmd := exec.Command("sleep", "0.5")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("failed to start command: %v", err)
+	}
+	defer func() { _ = cmd.Wait() }()
+
+	w, err := c.Watch(cmd.Process.Pid)
+	if err != nil {
+		if os.IsPermission(err) {
+			t.Skipf("taskstats requires elevated permission: %v", err)
+		}
+
+		t.Fatalf("failed to watch process: %v", err)
+	}
+	defer w.Close()
+
+	if _, err := w.Stats(); err != nil {
+		t.Fatalf("failed to retrieve live stats: %v", err)
+	}
+
+	stats, err := w.Wait()
+	if err != nil {
+		t.Fatalf("failed to wait for exit: %v", err)
+	}
+
+	if stats.PID != cmd.Process.Pid {
+		t.Fatalf("unexpected PID: %d, want: %d", stats.PID, cmd.Process.Pid)
+	}
+}
+
+func testMeasure(t *testing.T, c *taskstats.Client) {
+	stats, err := c.Measure(func() {
+		time.Sleep(10 * time.Millisecond)
+	})
+	if err != nil {
+		if os.IsPermission(err) {
+			t.Skipf("taskstats requires elevated permission: %v", err)
+		}
+
+		t.Fatalf("failed to measure: %v", err)
+	}
+
+	if stats.ElapsedTime <= 0 {
+		t.Fatalf("expected positive elapsed time: %+v", stats)
+	}
+}
+
+func testCGroupTree(t *testing.T, c *taskstats.Client) {
+	tree, err := c.CGroupTree(cgroupV1CPU(t))
+	if err != nil {
+		t.Fatalf("failed to walk cgroup tree: %v", err)
+	}
+
+	if total := tree.Total(); total.Sleeping+total.Running == 0 {
+		t.Fatalf("expected tasks in cgroup hierarchy, but found none: %+v", total)
+	}
+}
+
+func testCGroupTaskStats(t *testing.T, c *taskstats.Client) {
+	stats, err := c.CGroupTaskStats(cgroupV1CPU(t))
+	if err != nil {
+		t.Fatalf("failed to retrieve cgroup task stats: %v", err)
+	}
+
+	// At least this process has been scheduled.
+	if stats.CPUDelayCount == 0 {
+		t.Fatalf("expected non-zero CPU delay count: %+v", stats)
+	}
+}
+
+func testCGroupStatsFile(t *testing.T, c *taskstats.Client) {
+	f, err := os.Open(cgroupV1CPU(t))
+	if err != nil {
+		t.Fatalf("failed to open cgroup CPU hierarchy: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := c.CGroupStatsFile(f); err != nil {
+		t.Fatalf("failed to retrieve cgroup stats: %v", err)
+	}
+}
+
+func testCGroupStatsID(t *testing.T, c *taskstats.Client) {
+	mode, err := taskstats.DetectCGroupMode()
+	if err != nil {
+		t.Fatalf("failed to detect cgroup mode: %v", err)
+	}
+	if mode != taskstats.CGroupModeHybrid {
+		t.Skipf("cgroup ID lookup requires a hybrid cgroup layout, found: %s", mode)
+	}
+
+	// The cgroup ID is the kernfs file handle of the cgroup directory.
+	h, _, err := unix.NameToHandleAt(unix.AT_FDCWD, "/sys/fs/cgroup/unified", 0)
+	if err != nil {
+		t.Skipf("failed to get cgroup file handle: %v", err)
+	}
+	id := binary.NativeEndian.Uint64(h.Bytes())
+
+	if _, err := c.CGroupStatsID(id); err != nil {
+		if os.IsPermission(err) {
+			t.Skipf("opening cgroup by ID requires elevated permission: %v", err)
+		}
+
+		t.Fatalf("failed to retrieve cgroup stats by ID: %v", err)
+	}
+
+	if _, err := c.CGroupStatsID(^uint64(0)); !os.IsNotExist(err) {
+		t.Fatalf("expected is not exist, but got: %v", err)
+	}
+}
+
+func testCollector(t *testing.T, c *taskstats.Client) {
+	col := taskstats.NewCollector(c, nil)
+
+	if _, err := col.Collect(); err != nil {
+		t.Fatalf("failed to collect: %v", err)
+	}
+
+	time.Sleep(50 * time.Millisecond)
+
+	samples, err := col.Collect()
+	if err != nil {
+		t.Fatalf("failed to collect: %v", err)
+	}
+	if len(samples) != 1 || samples[0].Delta == nil {
+		t.Fatalf("expected one sample with a delta, but got: %+v", samples)
+	}
+
+	s := samples[0]
+	if s.Stats.MinorPageFaults == 0 {
+		t.Fatalf("expected page faults summed over threads, but got none")
+	}
+	if d := s.Delta.ElapsedTime; d < 50*time.Millisecond || d > time.Minute {
+		t.Fatalf("unexpected elapsed time between samples: %v", d)
+	}
 }
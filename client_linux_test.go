@@ -351,7 +351,14 @@ func TestLinuxClientPIDOK(t *testing.T) {
 		Swapin_delay_total:    11,
 		Freepages_count:       12,
 		Freepages_delay_total: 13,
+		Ac_uid:                1000,
+		Ac_exitcode:           256,
+		Ac_flag:               0x01,
+		Hiwater_rss:           2,
+		Read_bytes:            3,
 	}
+	// The element type of Ac_comm varies by architecture.
+	copy((*[len(stats.Ac_comm)]byte)(unsafe.Pointer(&stats.Ac_comm))[:], "test")
 
 	fn := func(_ genetlink.Message, _ netlink.Message) ([]genetlink.Message, error) {
 		// Cast unix.Taskstats structure into a byte array with the correct size.
@@ -382,6 +389,13 @@ func TestLinuxClientPIDOK(t *testing.T) {
 	}
 
 	tstats := Stats{
+		PID:                 pid,
+		UID:                 1000,
+		Comm:                "test",
+		ExitCode:            256,
+		Flags:               AccountingForked,
+		PeakRSS:             2048,
+		ReadBytes:           3,
 		ElapsedTime:         time.Duration(0),
 		UserCPUTime:         time.Microsecond * 1,
 		SystemCPUTime:       time.Microsecond * 2,
@@ -458,6 +472,7 @@ func TestLinuxClientTGIDOK(t *testing.T) {
 	}
 
 	tstats := Stats{
+		PID:                 tgid,
 		ElapsedTime:         time.Duration(0),
 		UserCPUTime:         time.Microsecond * 1,
 		SystemCPUTime:       time.Microsecond * 2,
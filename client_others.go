@@ -33,6 +33,21 @@ func (c *client) CGroupStats(path string) (*CGroupStats, error) {
 	return nil, errUnimplemented
 }
 
+// CGroupStatsFD implements osClient.
+func (c *client) CGroupStatsFD(fd int) (*CGroupStats, error) {
+	return nil, errUnimplemented
+}
+
+// CGroupStatsID implements osClient.
+func (c *client) CGroupStatsID(id uint64) (*CGroupStats, error) {
+	return nil, errUnimplemented
+}
+
+// CGroupTree implements osClient.
+func (c *client) CGroupTree(path string) (*CGroupTree, error) {
+	return nil, errUnimplemented
+}
+
 // PID implements osClient.
 func (c *client) PID(pid int) (*Stats, error) {
 	return nil, errUnimplemented
@@ -42,3 +57,8 @@ func (c *client) PID(pid int) (*Stats, error) {
 func (c *client) TGID(tgid int) (*Stats, error) {
 	return nil, errUnimplemented
 }
+
+// gettid always returns 0.
+func gettid() int {
+	return 0
+}
@@ -0,0 +1,123 @@
+package taskstats
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestClientMeasure(t *testing.T) {
+	var (
+		calls int
+		tids  []int
+	)
+
+	c := &Client{c: &testOSClient{
+		pid: func(pid int) (*Stats, error) {
+			calls++
+			tids = append(tids, pid)
+
+			return &Stats{
+				PID:          pid,
+				ElapsedTime:  time.Duration(calls) * time.Second,
+				CPUDelay:     time.Duration(calls*calls) * time.Millisecond,
+				BlockIODelay: time.Duration(calls) * time.Millisecond,
+			}, nil
+		},
+	}}
+
+	// Capture the thread while Measure holds it locked, as the goroutine may
+	// move to another thread once Measure returns.
+	tid := -1
+	got, err := c.Measure(func() { tid = gettid() })
+	if err != nil {
+		t.Fatalf("failed to measure: %v", err)
+	}
+
+	if tid == -1 {
+		t.Fatal("measured function was not called")
+	}
+
+	want := &Stats{
+		PID:          tid,
+		ElapsedTime:  time.Second,
+		CPUDelay:     3 * time.Millisecond,
+		BlockIODelay: time.Millisecond,
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected delta (-want +got):\n%s", diff)
+	}
+
+	// Both samples must describe the same thread.
+	if diff := cmp.Diff([]int{tid, tid}, tids); diff != "" {
+		t.Fatalf("unexpected thread IDs (-want +got):\n%s", diff)
+	}
+}
+
+func TestProcessStats(t *testing.T) {
+	threads := map[int]*Stats{
+		1: {
+			PID:         1,
+			PPID:        2,
+			TGID:        1,
+			Comm:        "foo",
+			BeginTime:   time.Unix(100, 0),
+			ElapsedTime: 3 * time.Second,
+			UserCPUTime: time.Second,
+			PeakRSS:     4096,
+		},
+		3: {PID: 3, TGID: 1, Comm: "bar", ElapsedTime: time.Second, MinorPageFaults: 3, ReadBytes: 3},
+	}
+
+	pid := func(pid int) (*Stats, error) {
+		s, ok := threads[pid]
+		if !ok {
+			return nil, os.ErrNotExist
+		}
+
+		return s, nil
+	}
+
+	// Thread 4 exited after the threads were listed.
+	group := &Stats{ElapsedTime: 4 * time.Second, CPUDelayCount: 5}
+	got, err := processStats(1, group, []int{1, 3, 4}, pid)
+	if err != nil {
+		t.Fatalf("failed to combine statistics: %v", err)
+	}
+
+	want := &Stats{
+		PID:              1,
+		PPID:             2,
+		TGID:             1,
+		Comm:             "foo",
+		BeginTime:        time.Unix(100, 0),
+		ElapsedTime:      3 * time.Second,
+		GroupElapsedTime: 3 * time.Second,
+		UserCPUTime:      time.Second,
+		MinorPageFaults:  3,
+		CPUDelayCount:    5,
+		PeakRSS:          4096,
+		ReadBytes:        3,
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected stats (-want +got):\n%s", diff)
+	}
+
+	if _, err := processStats(4, group, []int{4}, pid); !os.IsNotExist(err) {
+		t.Fatalf("expected is not exist for exited leader, but got: %v", err)
+	}
+}
+
+var _ osClient = &testOSClient{}
+
+// A testOSClient is an osClient which retrieves PID statistics using pid.
+type testOSClient struct {
+	osClient
+	pid func(pid int) (*Stats, error)
+}
+
+func (c *testOSClient) PID(pid int) (*Stats, error) { return c.pid(pid) }
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mdlayher/taskstats"
+	"github.com/mdlayher/taskstats/export"
+)
+
+// A querier retrieves statistics for tasks and cgroups.
+type querier interface {
+	CGroupStatsFile(f *os.File) (*taskstats.CGroupStats, error)
+	PID(pid int) (*taskstats.Stats, error)
+	Process(tgid int) (*taskstats.Stats, error)
+}
+
+// An exitStream is a stream of exit events.
+type exitStream interface {
+	Exits() <-chan taskstats.Exit
+	Err() error
+	Close() error
+}
+
+// A handler serves the HTTP API.
+type handler struct {
+	q       querier
+	open    func(path string) (*os.File, error)
+	listen  func() (exitStream, error)
+	collect func() ([]taskstats.Sample, error)
+}
+
+// newHandler creates an http.Handler which retrieves statistics using q, exit
+// events using listen, and the samples exposed as metrics using collect.
+// Cgroup directories requested by clients are opened using open, which must
+// confine them to cgroup filesystems.
+func newHandler(
+	q querier,
+	open func(path string) (*os.File, error),
+	listen func() (exitStream, error),
+	collect func() ([]taskstats.Sample, error),
+) http.Handler {
+	h := &handler{
+		q:       q,
+		open:    open,
+		listen:  listen,
+		collect: collect,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /pid/{id}", h.task(q.PID))
+	mux.HandleFunc("GET /tgid/{id}", h.task(q.Process))
+	mux.HandleFunc("GET /cgroup", h.cgroup)
+	mux.HandleFunc("GET /exits", h.exits)
+	mux.HandleFunc("GET /metrics", h.metrics)
+
+	return mux
+}
+
+// task returns a handler which serves the statistics retrieved by query for
+// the task identified in the request path.
+func (h *handler) task(query func(id int) (*taskstats.Stats, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil || id <= 0 {
+			http.Error(w, "invalid task ID", http.StatusBadRequest)
+			return
+		}
+
+		stats, err := query(id)
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+
+		writeJSON(w, stats)
+	}
+}
+
+// cgroup serves the statistics of the cgroup in the path query parameter.
+func (h *handler) cgroup(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Query().Get("path")
+	if path == "" {
+		http.Error(w, "missing cgroup path", http.StatusBadRequest)
+		return
+	}
+
+	// Query the directory which was opened, so it cannot be replaced by a
+	// symlink outside of the cgroup filesystem. Failing to open it is
+	// reported uniformly, so clients cannot probe other files.
+	dir, err := h.open(path)
+	if err != nil {
+		httpError(w, os.ErrPermission)
+		return
+	}
+	defer dir.Close()
+
+	stats, err := h.q.CGroupStatsFile(dir)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+
+	writeJSON(w, stats)
+}
+
+// An exitJSON is the JSON encoding of a taskstats.Exit.
+type exitJSON struct {
+	PID       int              `json:"pid"`
+	Stats     *taskstats.Stats `json:"stats"`
+	TGID      int              `json:"tgid,omitempty"`
+	TGIDStats *taskstats.Stats `json:"tgid_stats,omitempty"`
+	Time      time.Time        `json:"time"`
+}
+
+// exits streams exit events until the client disconnects, as server-sent
+// events if the client accepts them, and as newline-delimited JSON otherwise.
+func (h *handler) exits(w http.ResponseWriter, r *http.Request) {
+	l, err := h.listen()
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	defer l.Close()
+
+	sse := strings.Contains(r.Header.Get("Accept"), "text/event-stream")
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+	} else {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+	}
+	w.Header().Set("Cache-Control", "no-cache")
+
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-l.Exits():
+			if !ok {
+				// Headers are already sent, so the error can only be
+				// reported by ending the stream.
+				return
+			}
+
+			b, err := json.Marshal(exitJSON{
+				PID:       e.PID,
+				Stats:     e.Stats,
+				TGID:      e.TGID,
+				TGIDStats: e.TGIDStats,
+				Time:      e.Time,
+			})
+			if err != nil {
+				return
+			}
+
+			if sse {
+				b = append(append([]byte("data: "), b...), '\n', '\n')
+			} else {
+				b = append(b, '\n')
+			}
+
+			if _, err := w.Write(b); err != nil {
+				return
+			}
+			if err := rc.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// metrics serves the statistics of the collected processes in the
+// OpenMetrics text format, which Prometheus understands.
+func (h *handler) metrics(w http.ResponseWriter, r *http.Request) {
+	samples, err := h.collect()
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+
+	ss := make([]export.Sample, 0, len(samples))
+	for _, s := range samples {
+		// Timestamps are left to the scraper.
+		ss = append(ss, export.Sample{TGID: s.TGID, Stats: s.Stats})
+	}
+
+	w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+	_ = export.WriteOpenMetrics(w, ss)
+}
+
+// checkHost returns an http.Handler which only serves requests whose Host
+// header, without any port, is one of hosts, using next. This prevents a web
+// page whose host name resolves to the address of a TCP listener, as in DNS
+// rebinding, from reading the responses.
+func checkHost(next http.Handler, hosts []string) http.Handler {
+	allowed := make(map[string]bool, len(hosts))
+	for _, h := range hosts {
+		allowed[strings.ToLower(h)] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+
+		if !allowed[strings.ToLower(strings.Trim(host, "[]"))] {
+			http.Error(w, "invalid host", http.StatusMisdirectedRequest)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// httpError writes an HTTP error response for err.
+func httpError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		code = http.StatusNotFound
+	case errors.Is(err, os.ErrPermission):
+		code = http.StatusForbidden
+	case errors.Is(err, errors.ErrUnsupported):
+		code = http.StatusNotImplemented
+	}
+
+	http.Error(w, err.Error(), code)
+}
+
+// writeJSON writes v as a JSON response.
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
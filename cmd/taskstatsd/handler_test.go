@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/taskstats"
+)
+
+func TestHandler(t *testing.T) {
+	stats := &taskstats.Stats{PID: 1, TGID: 1, Comm: "foo", UserCPUTime: time.Second}
+
+	exits := &testExitStream{exitC: make(chan taskstats.Exit, 1)}
+	exits.exitC <- taskstats.Exit{PID: 1, Stats: stats, Time: time.Unix(100, 0)}
+
+	// Only cgroup paths beneath the cgroup root are opened.
+	cgroup := t.TempDir()
+	open := func(path string) (*os.File, error) {
+		if !strings.HasPrefix(path, "/sys/fs/cgroup/") {
+			return nil, errors.New("not a cgroup")
+		}
+
+		return os.Open(cgroup)
+	}
+
+	srv := httptest.NewServer(newHandler(
+		&testQuerier{stats: stats},
+		open,
+		func() (exitStream, error) { return exits, nil },
+		func() ([]taskstats.Sample, error) {
+			return []taskstats.Sample{{TGID: 1, Stats: &taskstats.Stats{NoDelays: true}}}, nil
+		},
+	))
+	defer srv.Close()
+
+	tests := []struct {
+		name, path string
+		code       int
+		body       string
+	}{
+		{
+			name: "PID",
+			path: "/pid/1",
+			code: http.StatusOK,
+			body: mustJSON(t, stats),
+		},
+		{
+			name: "TGID",
+			path: "/tgid/1",
+			code: http.StatusOK,
+			body: mustJSON(t, stats),
+		},
+		{
+			name: "not exist",
+			path: "/tgid/2",
+			code: http.StatusNotFound,
+			body: "file does not exist\n",
+		},
+		{
+			name: "bad ID",
+			path: "/pid/foo",
+			code: http.StatusBadRequest,
+			body: "invalid task ID\n",
+		},
+		{
+			name: "cgroup",
+			path: "/cgroup?path=/sys/fs/cgroup/cpu",
+			code: http.StatusOK,
+			body: mustJSON(t, &taskstats.CGroupStats{Running: 1}),
+		},
+		{
+			name: "cgroup denied",
+			path: "/cgroup?path=/root",
+			code: http.StatusForbidden,
+			body: "permission denied\n",
+		},
+		{
+			name: "cgroup missing path",
+			path: "/cgroup",
+			code: http.StatusBadRequest,
+			body: "missing cgroup path\n",
+		},
+		{
+			name: "metrics",
+			path: "/metrics",
+			code: http.StatusOK,
+			body: strings.Join([]string{
+				"# TYPE taskstats_elapsed_seconds counter",
+				"# UNIT taskstats_elapsed_seconds seconds",
+				"# HELP taskstats_elapsed_seconds Wall clock time elapsed since the process or thread started.",
+				`taskstats_elapsed_seconds_total{tgid="1"} 0`,
+			}, "\n"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := http.Get(srv.URL + tt.path)
+			if err != nil {
+				t.Fatalf("failed to request: %v", err)
+			}
+			defer res.Body.Close()
+
+			b, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatalf("failed to read body: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.code, res.StatusCode); diff != "" {
+				t.Fatalf("unexpected status code (-want +got):\n%s", diff)
+			}
+
+			// Only check the beginning of lengthy metrics output.
+			got := string(b)
+			if tt.name == "metrics" {
+				got = got[:min(len(got), len(tt.body))]
+			}
+
+			if diff := cmp.Diff(tt.body, got); diff != "" {
+				t.Fatalf("unexpected body (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	t.Run("exits", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, srv.URL+"/exits", nil)
+		if err != nil {
+			t.Fatalf("failed to create request: %v", err)
+		}
+		req.Header.Set("Accept", "text/event-stream")
+
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("failed to request: %v", err)
+		}
+		defer res.Body.Close()
+
+		if diff := cmp.Diff("text/event-stream", res.Header.Get("Content-Type")); diff != "" {
+			t.Fatalf("unexpected content type (-want +got):\n%s", diff)
+		}
+
+		line, err := bufio.NewReader(res.Body).ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read event: %v", err)
+		}
+
+		var e exitJSON
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e); err != nil {
+			t.Fatalf("failed to unmarshal event: %v", err)
+		}
+
+		if diff := cmp.Diff(exitJSON{PID: 1, Stats: stats, Time: time.Unix(100, 0)}, e); diff != "" {
+			t.Fatalf("unexpected exit (-want +got):\n%s", diff)
+		}
+	})
+}
+
+func TestCheckHost(t *testing.T) {
+	h := checkHost(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}), []string{"localhost", "::1"})
+
+	tests := []struct {
+		host string
+		code int
+	}{
+		{host: "localhost", code: http.StatusNoContent},
+		{host: "LOCALHOST:9103", code: http.StatusNoContent},
+		{host: "[::1]:9103", code: http.StatusNoContent},
+		{host: "[::1]", code: http.StatusNoContent},
+		{host: "attacker.example:9103", code: http.StatusMisdirectedRequest},
+		{host: "127.0.0.1:9103", code: http.StatusMisdirectedRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			r.Host = tt.host
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			if diff := cmp.Diff(tt.code, w.Code); diff != "" {
+				t.Fatalf("unexpected status code (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func mustJSON(t *testing.T, v any) string {
+	t.Helper()
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("failed to marshal JSON: %v", err)
+	}
+
+	return string(b) + "\n"
+}
+
+var _ querier = &testQuerier{}
+
+// A testQuerier is a querier which returns fixed statistics.
+type testQuerier struct {
+	stats *taskstats.Stats
+}
+
+func (q *testQuerier) CGroupStatsFile(_ *os.File) (*taskstats.CGroupStats, error) {
+	return &taskstats.CGroupStats{Running: 1}, nil
+}
+
+func (q *testQuerier) PID(pid int) (*taskstats.Stats, error) {
+	if pid != q.stats.PID {
+		return nil, os.ErrNotExist
+	}
+
+	return q.stats, nil
+}
+
+func (q *testQuerier) Process(tgid int) (*taskstats.Stats, error) {
+	return q.PID(tgid)
+}
+
+var _ exitStream = &testExitStream{}
+
+// A testExitStream is an exitStream which sends exits from a channel.
+type testExitStream struct {
+	exitC chan taskstats.Exit
+}
+
+func (s *testExitStream) Exits() <-chan taskstats.Exit { return s.exitC }
+func (s *testExitStream) Err() error                   { return nil }
+func (s *testExitStream) Close() error                 { return nil }
@@ -0,0 +1,189 @@
+// Command taskstatsd serves taskstats statistics over HTTP, for dashboards
+// and ad-hoc queries during incident response.
+//
+// The following endpoints are served:
+//   - /pid/{id}: statistics for a thread, as JSON
+//   - /tgid/{id}: statistics for a process, as JSON
+//   - /cgroup?path={path}: statistics for a cgroup, as JSON
+//   - /exits: a stream of exit events, as newline-delimited JSON, or as
+//     server-sent events for clients which accept text/event-stream
+//   - /metrics: statistics for selected processes, in the OpenMetrics format
+//     understood by Prometheus
+//
+// taskstatsd requires elevated privileges, and serves the statistics of every
+// process to its clients, so by default it listens on the Unix socket
+// /run/taskstatsd.sock and only accepts connections from processes running as
+// root or as a user listed by -unix.uids, as reported by SO_PEERCRED.
+//
+// Use -addr to listen on TCP instead, such as for a Prometheus scraper. Any
+// local process may connect to a TCP socket, so only requests whose Host
+// header names one of -hosts are served, which prevents web pages from
+// reaching taskstatsd through DNS rebinding.
+//
+// Cgroup paths requested by clients must be beneath -cgroup.root and in a
+// cgroup filesystem.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mdlayher/taskstats"
+)
+
+func main() {
+	var (
+		unix   = flag.String("unix", "/run/taskstatsd.sock", "Unix socket path to listen on")
+		uids   = flag.String("unix.uids", "", "comma-separated UIDs permitted to connect to -unix, in addition to root")
+		addr   = flag.String("addr", "", "TCP address to listen on, such as localhost:9103, instead of -unix")
+		hosts  = flag.String("hosts", "localhost,127.0.0.1,::1", "comma-separated host names permitted in requests to -addr")
+		root   = flag.String("cgroup.root", "/sys/fs/cgroup", "directory beneath which cgroups may be requested")
+		names  = flag.String("metrics.names", "", "regular expression selecting processes exposed as metrics by command name")
+		cgroup = flag.String("metrics.cgroup", "", "cgroup directory whose processes are exposed as metrics")
+		all    = flag.Bool("metrics.all", false, "expose every process as metrics")
+	)
+	flag.Parse()
+
+	targets := taskstats.Targets{
+		Self: true,
+		All:  *all,
+	}
+	if *names != "" {
+		re, err := regexp.Compile(*names)
+		if err != nil {
+			log.Fatalf("invalid -metrics.names: %v", err)
+		}
+		targets.Names = []*regexp.Regexp{re}
+	}
+	if *cgroup != "" {
+		targets.CGroups = []string{*cgroup}
+	}
+
+	allowed := map[uint32]bool{0: true}
+	for _, f := range strings.Split(*uids, ",") {
+		if f == "" {
+			continue
+		}
+
+		uid, err := strconv.ParseUint(f, 10, 32)
+		if err != nil {
+			log.Fatalf("invalid -unix.uids: %v", err)
+		}
+		allowed[uint32(uid)] = true
+	}
+
+	c, err := taskstats.New()
+	if err != nil {
+		log.Fatalf("failed to open taskstats: %v", err)
+	}
+	defer c.Close()
+
+	l, err := listen(*addr, *unix, func(uid uint32) bool { return allowed[uid] })
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+
+	col := taskstats.NewCollector(c, &taskstats.CollectorConfig{Targets: targets})
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+
+	var h http.Handler = newHandler(
+		c,
+		func(path string) (*os.File, error) { return taskstats.OpenCGroupDir(*root, path) },
+		func() (exitStream, error) { return taskstats.ListenExits(nil) },
+		col.Collect,
+	)
+	if *addr != "" {
+		h = checkHost(h, strings.Split(*hosts, ","))
+	}
+
+	srv := &http.Server{
+		Handler:           h,
+		ReadHeaderTimeout: 10 * time.Second,
+		// Cancel exit streams on shutdown.
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		sctx, scancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer scancel()
+		_ = srv.Shutdown(sctx)
+	}()
+
+	log.Printf("listening on %s", l.Addr())
+	if err := srv.Serve(l); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("failed to serve: %v", err)
+	}
+}
+
+// listen listens on the TCP address addr if set, and on the Unix socket at
+// path otherwise. Connections to the Unix socket are only accepted from
+// processes whose UID satisfies allow. A stale Unix socket left by a previous
+// run is removed.
+func listen(addr, path string, allow func(uid uint32) bool) (net.Listener, error) {
+	if addr != "" {
+		return net.Listen("tcp", addr)
+	}
+
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	// Any user may connect, and is then authorized by its credentials.
+	if err := os.Chmod(path, 0o666); err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+
+	return &peerListener{Listener: l, allow: allow}, nil
+}
+
+// A peerListener is a Unix socket listener which only accepts connections
+// from processes whose UID, as reported by the kernel, satisfies allow.
+type peerListener struct {
+	net.Listener
+	allow func(uid uint32) bool
+}
+
+// Accept implements net.Listener, closing connections which are not allowed.
+func (l *peerListener) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		uid, err := peerUID(c)
+		if err == nil && l.allow(uid) {
+			return c, nil
+		}
+
+		if err != nil {
+			log.Printf("rejected connection: %v", err)
+		} else {
+			log.Printf("rejected connection from UID %d", uid)
+		}
+		_ = c.Close()
+	}
+}
@@ -0,0 +1,42 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// peerUID returns the UID of the process at the other end of the Unix socket
+// connection c.
+func peerUID(c net.Conn) (uint32, error) {
+	uc, ok := c.(*net.UnixConn)
+	if !ok {
+		return 0, errors.New("not a Unix socket connection")
+	}
+
+	rc, err := uc.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		cred *unix.Ucred
+		cerr error
+	)
+	err = rc.Control(func(fd uintptr) {
+		cred, cerr = unix.GetsockoptUcred(int(fd), unix.SOL_SOCKET, unix.SO_PEERCRED)
+	})
+	if err != nil {
+		return 0, err
+	}
+	if cerr != nil {
+		return 0, os.NewSyscallError("getsockopt", cerr)
+	}
+
+	return cred.Uid, nil
+}
@@ -0,0 +1,67 @@
+//go:build linux
+// +build linux
+
+package main
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestListenPeer(t *testing.T) {
+	uid := uint32(os.Getuid())
+
+	tests := []struct {
+		name  string
+		allow bool
+	}{
+		{name: "allowed", allow: true},
+		{name: "denied"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "taskstatsd.sock")
+			l, err := listen("", path, func(got uint32) bool { return tt.allow && got == uid })
+			if err != nil {
+				t.Fatalf("failed to listen: %v", err)
+			}
+			defer l.Close()
+
+			accepted := make(chan net.Conn, 1)
+			go func() {
+				c, err := l.Accept()
+				if err == nil {
+					accepted <- c
+				}
+			}()
+
+			c, err := net.Dial("unix", path)
+			if err != nil {
+				t.Fatalf("failed to dial: %v", err)
+			}
+			defer c.Close()
+
+			if !tt.allow {
+				// The connection is closed without being accepted.
+				_ = c.SetReadDeadline(time.Now().Add(5 * time.Second))
+				if _, err := c.Read(make([]byte, 1)); !errors.Is(err, io.EOF) {
+					t.Fatalf("expected EOF, but got: %v", err)
+				}
+				return
+			}
+
+			select {
+			case sc := <-accepted:
+				_ = sc.Close()
+			case <-time.After(5 * time.Second):
+				t.Fatal("timed out waiting for connection")
+			}
+		})
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+)
+
+// peerUID always returns an error.
+func peerUID(_ net.Conn) (uint32, error) {
+	return 0, fmt.Errorf("peer credentials not implemented on %s/%s", runtime.GOOS, runtime.GOARCH)
+}
@@ -0,0 +1,329 @@
+package taskstats
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Targets selects the processes sampled by a Collector. Processes matching
+// any of the fields are selected.
+type Targets struct {
+	// Self selects the current process.
+	Self bool
+
+	// TGIDs selects processes by their TGID.
+	TGIDs []int
+
+	// Names selects processes whose command name, as reported by
+	// /proc/(pid)/comm, matches any of the regular expressions.
+	Names []*regexp.Regexp
+
+	// CGroups selects the processes in the cgroup directories and their
+	// descendants.
+	CGroups []string
+
+	// All selects every running process.
+	All bool
+}
+
+// A CollectorConfig configures a Collector.
+type CollectorConfig struct {
+	// Targets selects the processes to sample. Targets are discovered anew
+	// for each collection, so processes matching Names and CGroups are picked
+	// up as they start.
+	Targets Targets
+
+	// Interval sets the time between collections. If zero, a default of 10
+	// seconds is used.
+	Interval time.Duration
+
+	// Jitter, if non-zero, adds a random delay of up to Jitter to each
+	// interval, so that many collectors started at once do not poll in
+	// lockstep.
+	Jitter time.Duration
+}
+
+// A Sample contains the statistics for one process at one collection.
+type Sample struct {
+	// TGID identifies the process.
+	TGID int
+
+	// Time is when the sample was collected.
+	Time time.Time
+
+	// Stats contains the cumulative statistics of the process.
+	Stats *Stats
+
+	// Delta contains the change in Stats since the previous sample of the
+	// process, with ElapsedTime set to the time elapsed between the samples.
+	// Delta is nil for the first sample of a process, including when its TGID
+	// has been reused by a new process since the previous sample.
+	Delta *Stats
+}
+
+// A Collector periodically samples statistics for a set of processes and
+// publishes them to subscribers.
+type Collector struct {
+	cfg      CollectorConfig
+	query    func(tgid int) (*Stats, error)
+	discover func() ([]int, error)
+	start    func(tgid int) (uint64, error)
+	now      func() time.Time
+
+	mu    sync.Mutex
+	prev  map[int]collected
+	subs  map[chan []Sample]struct{}
+	funcs []func([]Sample)
+}
+
+// NewCollector creates a Collector which samples processes using c. If cfg is
+// nil, a default configuration which samples the current process is used.
+//
+// Processes are sampled using Client.Process, so that CPU time, page faults
+// and I/O are summed over their threads.
+func NewCollector(c *Client, cfg *CollectorConfig) *Collector {
+	if cfg == nil {
+		cfg = &CollectorConfig{Targets: Targets{Self: true}}
+	}
+
+	return newCollector(c.Process, *cfg)
+}
+
+// newCollector creates a Collector which samples processes using query.
+func newCollector(query func(tgid int) (*Stats, error), cfg CollectorConfig) *Collector {
+	if cfg.Interval == 0 {
+		cfg.Interval = 10 * time.Second
+	}
+
+	c := &Collector{
+		cfg:   cfg,
+		query: query,
+		start: procStartTime,
+		now:   time.Now,
+		prev:  make(map[int]collected),
+		subs:  make(map[chan []Sample]struct{}),
+	}
+	c.discover = c.targets
+
+	return c
+}
+
+// collected is the previous sample of a process, used to compute deltas.
+type collected struct {
+	// start is the start time of the process, which distinguishes it from a
+	// later process reusing its TGID.
+	start uint64
+	time  time.Time
+	stats *Stats
+}
+
+// Subscribe returns a channel which receives the samples from each
+// collection, and a function which unsubscribes and closes the channel.
+//
+// Samples are sent without blocking, so a subscriber which does not keep up
+// misses collections. buffer sets the capacity of the channel.
+func (c *Collector) Subscribe(buffer int) (<-chan []Sample, func()) {
+	ch := make(chan []Sample, buffer)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.subs[ch] = struct{}{}
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+
+			delete(c.subs, ch)
+			close(ch)
+		})
+	}
+}
+
+// Notify registers fn to be called with the samples from each collection. fn
+// is called synchronously by the collecting goroutine, so it should return
+// promptly.
+func (c *Collector) Notify(fn func([]Sample)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.funcs = append(c.funcs, fn)
+}
+
+// Run collects samples at the configured interval until ctx is canceled, and
+// then returns ctx.Err. If a collection fails, Run stops and returns its
+// error.
+func (c *Collector) Run(ctx context.Context) error {
+	for {
+		if _, err := c.Collect(); err != nil {
+			return err
+		}
+
+		wait := c.cfg.Interval
+		if c.cfg.Jitter > 0 {
+			wait += rand.N(c.cfg.Jitter)
+		}
+
+		t := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// Collect immediately samples the target processes, publishes the samples to
+// subscribers, and returns them ordered by TGID. Processes which exit during
+// collection are omitted.
+func (c *Collector) Collect() ([]Sample, error) {
+	tgids, err := c.discover()
+	if err != nil {
+		return nil, err
+	}
+
+	samples, err := c.sample(tgids)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	for ch := range c.subs {
+		select {
+		case ch <- samples:
+		default:
+		}
+	}
+	funcs := c.funcs
+	c.mu.Unlock()
+
+	// Call functions without holding the lock so they may subscribe.
+	for _, fn := range funcs {
+		fn(samples)
+	}
+
+	return samples, nil
+}
+
+// sample samples the processes identified by tgids, computing deltas against
+// the previous collection.
+func (c *Collector) sample(tgids []int) ([]Sample, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	samples := make([]Sample, 0, len(tgids))
+	prev := make(map[int]collected, len(tgids))
+
+	for _, tgid := range tgids {
+		start, err := c.start(tgid)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		stats, err := c.query(tgid)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		s := Sample{
+			TGID:  tgid,
+			Time:  now,
+			Stats: stats,
+		}
+
+		// A different start time means the TGID has been reused by a new
+		// process, in which case there is nothing to compare against.
+		if p, ok := c.prev[tgid]; ok && p.start == start {
+			s.Delta = stats.sub(p.stats)
+			s.Delta.ElapsedTime = now.Sub(p.time)
+		}
+
+		samples = append(samples, s)
+		prev[tgid] = collected{start: start, time: now, stats: stats}
+	}
+
+	// Forget processes which no longer exist or are no longer targeted.
+	c.prev = prev
+
+	return samples, nil
+}
+
+// targets discovers the TGIDs of the processes selected by the Collector's
+// targets, in ascending order.
+func (c *Collector) targets() ([]int, error) {
+	t := c.cfg.Targets
+	set := make(map[int]struct{})
+
+	if t.Self {
+		set[os.Getpid()] = struct{}{}
+	}
+
+	for _, tgid := range t.TGIDs {
+		set[tgid] = struct{}{}
+	}
+
+	for _, cg := range t.CGroups {
+		err := walkCGroupMembers(cg, func(id int, thread bool) error {
+			// Threads are not sampled individually.
+			if !thread {
+				set[id] = struct{}{}
+			}
+
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if t.All || len(t.Names) > 0 {
+		parents, err := procParents()
+		if err != nil {
+			return nil, err
+		}
+
+		for pid := range parents {
+			if t.All {
+				set[pid] = struct{}{}
+				continue
+			}
+
+			comm, err := procComm(pid)
+			if err != nil {
+				// Exited since procfs was scanned.
+				continue
+			}
+
+			for _, re := range t.Names {
+				if re.MatchString(comm) {
+					set[pid] = struct{}{}
+					break
+				}
+			}
+		}
+	}
+
+	tgids := make([]int, 0, len(set))
+	for tgid := range set {
+		tgids = append(tgids, tgid)
+	}
+	sort.Ints(tgids)
+
+	return tgids, nil
+}
@@ -0,0 +1,153 @@
+package taskstats
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCollectorCollect(t *testing.T) {
+	// Each collection returns increasing statistics for TGID 1, except that
+	// a thread has exited before the final collection, so its fault count
+	// decreases. TGID 2 exits after the first collection and is then reused.
+	var n int
+	query := func(tgid int) (*Stats, error) {
+		switch tgid {
+		case 1:
+			faults := uint64(n * 10)
+			if n == 3 {
+				faults = 5
+			}
+
+			return &Stats{
+				ElapsedTime:     time.Duration(n) * time.Second,
+				CPUDelay:        time.Duration(n*n) * time.Millisecond,
+				MinorPageFaults: faults,
+			}, nil
+		case 2:
+			switch n {
+			case 1:
+				return &Stats{ElapsedTime: time.Hour}, nil
+			case 2:
+				return nil, os.ErrNotExist
+			default:
+				return &Stats{ElapsedTime: 2 * time.Hour}, nil
+			}
+		default:
+			t.Fatalf("unexpected TGID: %d", tgid)
+			return nil, nil
+		}
+	}
+
+	c := newCollector(query, CollectorConfig{Targets: Targets{TGIDs: []int{2, 1}}})
+	c.start = func(tgid int) (uint64, error) {
+		if tgid == 2 && n == 3 {
+			return 200, nil
+		}
+
+		return uint64(tgid * 100), nil
+	}
+
+	epoch := time.Unix(100, 0)
+	c.now = func() time.Time { return epoch.Add(time.Duration(n) * 2 * time.Second) }
+
+	ch, unsubscribe := c.Subscribe(3)
+	var notified int
+	c.Notify(func(_ []Sample) { notified++ })
+
+	var got [][]Sample
+	for n = 1; n <= 3; n++ {
+		samples, err := c.Collect()
+		if err != nil {
+			t.Fatalf("failed to collect: %v", err)
+		}
+
+		got = append(got, samples)
+	}
+
+	at := func(n int) time.Time { return epoch.Add(time.Duration(n) * 2 * time.Second) }
+
+	want := [][]Sample{
+		{
+			{
+				TGID:  1,
+				Time:  at(1),
+				Stats: &Stats{ElapsedTime: time.Second, CPUDelay: time.Millisecond, MinorPageFaults: 10},
+			},
+			{TGID: 2, Time: at(1), Stats: &Stats{ElapsedTime: time.Hour}},
+		},
+		{{
+			TGID:  1,
+			Time:  at(2),
+			Stats: &Stats{ElapsedTime: 2 * time.Second, CPUDelay: 4 * time.Millisecond, MinorPageFaults: 20},
+			// Elapsed time is measured between samples.
+			Delta: &Stats{ElapsedTime: 2 * time.Second, CPUDelay: 3 * time.Millisecond, MinorPageFaults: 10},
+		}},
+		{
+			{
+				TGID:  1,
+				Time:  at(3),
+				Stats: &Stats{ElapsedTime: 3 * time.Second, CPUDelay: 9 * time.Millisecond, MinorPageFaults: 5},
+				// Decreased counters saturate at zero.
+				Delta: &Stats{ElapsedTime: 2 * time.Second, CPUDelay: 5 * time.Millisecond},
+			},
+			// Reused TGID has no delta, even though its elapsed time has
+			// increased.
+			{TGID: 2, Time: at(3), Stats: &Stats{ElapsedTime: 2 * time.Hour}},
+		},
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected samples (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(3, notified); diff != "" {
+		t.Fatalf("unexpected number of notifications (-want +got):\n%s", diff)
+	}
+
+	unsubscribe()
+	unsubscribe()
+
+	var received int
+	for range ch {
+		received++
+	}
+
+	if diff := cmp.Diff(3, received); diff != "" {
+		t.Fatalf("unexpected number of subscription samples (-want +got):\n%s", diff)
+	}
+}
+
+func TestCollectorTargets(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "cgroup.procs"), []byte("30\n10\n"), 0o644); err != nil {
+		t.Fatalf("failed to create cgroup.procs: %v", err)
+	}
+
+	c := newCollector(nil, CollectorConfig{
+		Targets: Targets{
+			Self:    true,
+			TGIDs:   []int{20, 10},
+			CGroups: []string{root},
+		},
+	})
+
+	tgids, err := c.targets()
+	if err != nil {
+		t.Fatalf("failed to discover targets: %v", err)
+	}
+
+	want := []int{10, 20, 30}
+	if pid := os.Getpid(); pid < 10 {
+		want = append([]int{pid}, want...)
+	} else {
+		want = append(want, pid)
+	}
+
+	if diff := cmp.Diff(want, tgids); diff != "" {
+		t.Fatalf("unexpected targets (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,230 @@
+package taskstats
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ContainerCGroups returns the cgroup directories of the Docker, containerd,
+// or CRI-O container identified by id. Id may be the full 64 character
+// container ID or a prefix of at least 12 characters.
+//
+// The cgroup v2 hierarchy and the cgroup v1 hierarchies for systemd and the
+// cpu controller are searched, so both cgroupfs layouts such as
+// /sys/fs/cgroup/cpu/docker/(id) and systemd layouts such as
+// /sys/fs/cgroup/system.slice/docker-(id).scope are found. If no cgroups are
+// found, an error compatible with os.IsNotExist is returned. If a prefix
+// matches more than one container, an error is returned rather than combining
+// their cgroups.
+func ContainerCGroups(id string) ([]string, error) {
+	id = strings.ToLower(id)
+	if len(id) < 12 {
+		return nil, errors.New("taskstats: container ID must have at least 12 characters")
+	}
+
+	paths, err := findCGroups(matchContainer(id))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkContainerIDs(id, paths); err != nil {
+		return nil, err
+	}
+
+	return paths, nil
+}
+
+// PodCGroups returns the cgroup directories of the Kubernetes pod identified
+// by uid, as created by the kubelet using either the cgroupfs or systemd
+// cgroup driver. The cgroups of the pod's containers are descendants of the
+// returned directories. If no cgroups are found, an error compatible with
+// os.IsNotExist is returned.
+func PodCGroups(uid string) ([]string, error) {
+	return findCGroups(matchPod(uid))
+}
+
+// UnitCGroups returns the cgroup directories of the systemd unit with the
+// specified name, such as "nginx.service". If no cgroups are found, an error
+// compatible with os.IsNotExist is returned.
+func UnitCGroups(name string) ([]string, error) {
+	return findCGroups(func(dir string) bool {
+		return dir == name
+	})
+}
+
+// matchContainer returns a function which reports whether a cgroup directory
+// name belongs to the container identified by id.
+func matchContainer(id string) func(name string) bool {
+	return func(name string) bool {
+		full := containerID(name)
+		return full != "" && strings.HasPrefix(full, id)
+	}
+}
+
+// checkContainerIDs returns an error if the cgroup directories in paths,
+// found using the container ID prefix id, belong to more than one container.
+func checkContainerIDs(id string, paths []string) error {
+	var full string
+	for _, p := range paths {
+		switch cid := containerID(filepath.Base(p)); {
+		case full == "":
+			full = cid
+		case cid != full:
+			return fmt.Errorf("taskstats: container ID %q is ambiguous: matches %s and %s", id, full, cid)
+		}
+	}
+
+	return nil
+}
+
+// matchPod returns a function which reports whether a cgroup directory name
+// belongs to the pod identified by uid.
+func matchPod(uid string) func(name string) bool {
+	// The systemd cgroup driver replaces dashes in the UID with underscores.
+	var (
+		cgroupfs = "pod" + uid
+		systemd  = "-pod" + strings.ReplaceAll(uid, "-", "_") + ".slice"
+	)
+
+	return func(name string) bool {
+		return name == cgroupfs || strings.HasSuffix(name, systemd)
+	}
+}
+
+// containerID returns the container ID embedded in a cgroup directory name,
+// or the empty string if name does not belong to a container.
+func containerID(name string) string {
+	// The systemd cgroup driver uses names such as docker-(id).scope, and the
+	// cgroupfs driver uses the ID alone.
+	if s, ok := strings.CutSuffix(name, ".scope"); ok {
+		i := strings.LastIndexByte(s, '-')
+		if i == -1 {
+			return ""
+		}
+		name = s[i+1:]
+	}
+
+	if len(name) != 64 {
+		return ""
+	}
+
+	for _, c := range name {
+		if !strings.ContainsRune("0123456789abcdef", c) {
+			return ""
+		}
+	}
+
+	return name
+}
+
+// ContainerStats contains statistics for the cgroups of a container, pod, or
+// service, and for the processes within them.
+type ContainerStats struct {
+	// CGroup is the cgroup directory whose task-state counts are reported by
+	// CGroupStats.
+	CGroup string
+
+	// CGroupStats contains the combined task-state counts of the cgroup and
+	// all of its descendants. It is nil on systems which only use the cgroup
+	// v2 unified hierarchy, which the kernel cannot report on.
+	CGroupStats *CGroupStats
+
+	// Processes contains statistics for each process in the cgroup or its
+	// descendants, keyed by TGID. Processes which exit while statistics are
+	// being retrieved are omitted.
+	Processes map[int]*Stats
+}
+
+// Total returns the combined statistics of every process in the container.
+// The identifiers of the result are zero.
+func (cs *ContainerStats) Total() *Stats {
+	var total Stats
+	for _, s := range cs.Processes {
+		total.add(s)
+	}
+
+	return &total
+}
+
+// ContainerStats retrieves statistics for a container, pod, or service using
+// its cgroup directories, as returned by ContainerCGroups, PodCGroups, or
+// UnitCGroups. Every directory contains the same processes, so task-state
+// counts are retrieved from the first directory the kernel supports, and
+// processes are discovered using the first directory which is not a cgroup v2
+// threaded cgroup, as threaded cgroups only list threads.
+//
+// The statistics of each process are retrieved using Process.
+func (c *Client) ContainerStats(paths []string) (*ContainerStats, error) {
+	if len(paths) == 0 {
+		return nil, os.ErrNotExist
+	}
+
+	cs := &ContainerStats{
+		Processes: make(map[int]*Stats),
+	}
+
+	for _, p := range paths {
+		tree, err := c.CGroupTree(p)
+		if err != nil {
+			if errors.Is(err, errors.ErrUnsupported) {
+				// cgroup v2 path without a v1 equivalent; try another.
+				continue
+			}
+
+			return nil, err
+		}
+
+		cs.CGroup = tree.Path
+		cs.CGroupStats = tree.Total()
+		break
+	}
+
+	root, err := domainCGroup(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	err = walkCGroupMembers(root, func(tgid int, thread bool) error {
+		if thread {
+			// Processes are accounted for by their threaded domain cgroup.
+			return nil
+		}
+
+		stats, err := c.Process(tgid)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			// Exited since cgroup.procs was read.
+			return nil
+		case err != nil:
+			return err
+		}
+
+		cs.Processes[tgid] = stats
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cs, nil
+}
+
+// domainCGroup returns the first of paths which is not a cgroup v2 threaded
+// cgroup, or the first path if all of them are.
+func domainCGroup(paths []string) (string, error) {
+	for _, p := range paths {
+		threaded, err := isThreadedCGroup(p)
+		if err != nil {
+			return "", err
+		}
+
+		if !threaded {
+			return p, nil
+		}
+	}
+
+	return paths[0], nil
+}
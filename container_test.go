@@ -0,0 +1,175 @@
+package taskstats
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMatchContainer(t *testing.T) {
+	id := strings.Repeat("4b825dc6", 8)
+
+	tests := []struct {
+		name string
+		id   string
+		dir  string
+		ok   bool
+	}{
+		{
+			name: "cgroupfs",
+			id:   id,
+			dir:  id,
+			ok:   true,
+		},
+		{
+			name: "docker systemd",
+			id:   id[:12],
+			dir:  "docker-" + id + ".scope",
+			ok:   true,
+		},
+		{
+			name: "containerd systemd",
+			id:   id[:12],
+			dir:  "cri-containerd-" + id + ".scope",
+			ok:   true,
+		},
+		{
+			name: "other container",
+			id:   "0123456789ab",
+			dir:  "docker-" + id + ".scope",
+		},
+		{
+			name: "truncated",
+			id:   id[:12],
+			dir:  id[:63],
+		},
+		{
+			name: "not hexadecimal",
+			id:   id[:12],
+			dir:  "docker-" + strings.ToUpper(id) + ".scope",
+		},
+		{
+			name: "unit",
+			id:   id[:12],
+			dir:  "session-1.scope",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.ok, matchContainer(tt.id)(tt.dir)); diff != "" {
+				t.Fatalf("unexpected match (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCheckContainerIDs(t *testing.T) {
+	var (
+		a = strings.Repeat("4b825dc6", 8)
+		b = a[:12] + strings.Repeat("0", 52)
+	)
+
+	tests := []struct {
+		name  string
+		paths []string
+		ok    bool
+	}{
+		{
+			name: "one container",
+			paths: []string{
+				"/sys/fs/cgroup/system.slice/docker-" + a + ".scope",
+				"/sys/fs/cgroup/cpu/docker/" + a,
+			},
+			ok: true,
+		},
+		{
+			name: "ambiguous",
+			paths: []string{
+				"/sys/fs/cgroup/system.slice/docker-" + a + ".scope",
+				"/sys/fs/cgroup/system.slice/docker-" + b + ".scope",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkContainerIDs(a[:12], tt.paths)
+			if tt.ok && err != nil {
+				t.Fatalf("failed to check container IDs: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("an error was expected, but none occurred")
+			}
+		})
+	}
+}
+
+func TestDomainCGroup(t *testing.T) {
+	root := t.TempDir()
+
+	types := map[string]string{
+		"threaded": "threaded\n",
+		"domain":   "domain threaded\n",
+	}
+
+	for dir, typ := range types {
+		path := filepath.Join(root, dir)
+		if err := os.Mkdir(path, 0o755); err != nil {
+			t.Fatalf("failed to create cgroup directory: %v", err)
+		}
+
+		if err := os.WriteFile(filepath.Join(path, "cgroup.type"), []byte(typ), 0o644); err != nil {
+			t.Fatalf("failed to create cgroup file: %v", err)
+		}
+	}
+
+	got, err := domainCGroup([]string{filepath.Join(root, "threaded"), filepath.Join(root, "domain")})
+	if err != nil {
+		t.Fatalf("failed to find domain cgroup: %v", err)
+	}
+
+	if diff := cmp.Diff(filepath.Join(root, "domain"), got); diff != "" {
+		t.Fatalf("unexpected cgroup (-want +got):\n%s", diff)
+	}
+}
+
+func TestMatchPod(t *testing.T) {
+	const uid = "8d3e2a3e-7c0e-4c59-a7d5-9f3f0a3c4b1e"
+
+	tests := []struct {
+		name string
+		dir  string
+		ok   bool
+	}{
+		{
+			name: "cgroupfs",
+			dir:  "pod" + uid,
+			ok:   true,
+		},
+		{
+			name: "systemd",
+			dir:  "kubepods-burstable-pod8d3e2a3e_7c0e_4c59_a7d5_9f3f0a3c4b1e.slice",
+			ok:   true,
+		},
+		{
+			name: "other pod",
+			dir:  "pod0d3e2a3e-7c0e-4c59-a7d5-9f3f0a3c4b1e",
+		},
+		{
+			name: "QoS class",
+			dir:  "kubepods-burstable.slice",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.ok, matchPod(uid)(tt.dir)); diff != "" {
+				t.Fatalf("unexpected match (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,256 @@
+package taskstats
+
+import (
+	"io"
+	"time"
+)
+
+// An Exit contains statistics for a task which has exited.
+//
+// The kernel sends an Exit for every task, including each thread of a
+// multithreaded process. Kernels implementing taskstats version 12 or newer
+// flag the last task of each process with AccountingGroupExited, and only
+// that Exit describes the whole process. Older kernels do not identify the
+// threads of a process, so each Exit is assumed to describe a
+// single-threaded process. On such kernels a thread group leader which exits
+// before its other threads is reported alone, and again with the thread
+// group statistics of its process when the last thread exits.
+type Exit struct {
+	// PID is the ID of the task which exited.
+	PID int
+
+	// Stats contains the final statistics for the task.
+	Stats *Stats
+
+	// TGID and TGIDStats are set when the exiting task was the last
+	// remaining thread in a multithreaded thread group. TGIDStats contains
+	// the thread group statistics reported by the kernel, which only account
+	// for the delays of every thread in the group and their ElapsedTime
+	// summed over the threads. The kernel reports no identifiers, begin
+	// time, CPU times, page faults, I/O or memory high-water marks for thread
+	// groups; those are only found in the Stats of each thread's Exit.
+	//
+	// The kernel does not report thread group statistics for single-threaded
+	// processes, in which case Stats describes the whole process.
+	TGID      int
+	TGIDStats *Stats
+
+	// Time is when the exit was received from the kernel, which reports each
+	// exit as the task exits. Exits received by different shards of an
+	// ExitListener are not delivered in order, so Time may be used to order
+	// them. Exits received in one batch share a Time, so a stable sort
+	// preserves their delivery order. It is zero if unknown.
+	Time time.Time
+}
+
+// process returns the TGID and final statistics of the process described by
+// e alone. ok is false if e describes the exit of a task whose process is
+// still running, in which case a later exit describes the whole process.
+//
+// The statistics of a multithreaded process lack the CPU times, page faults
+// and I/O of its threads, which an exitSet sums from their exits.
+func (e Exit) process() (tgid int, stats *Stats, ok bool) {
+	if e.TGIDStats != nil {
+		// The kernel does not fill in identifiers for thread group
+		// statistics, so borrow them from the last thread. Memory high-water
+		// marks are shared by every thread in the group, and the time elapsed
+		// since the thread group leader started is that of the process.
+		s := *e.TGIDStats
+		s.PID, s.PPID, s.TGID = e.TGID, e.Stats.PPID, e.TGID
+		s.UID, s.GID, s.Comm = e.Stats.UID, e.Stats.GID, e.Stats.Comm
+		s.ExitCode, s.Flags = e.Stats.ExitCode, e.Stats.Flags
+		s.PeakRSS, s.PeakVirtualMemory = e.Stats.PeakRSS, e.Stats.PeakVirtualMemory
+		s.BeginTime = e.Stats.groupBeginTime()
+		s.ElapsedTime, s.GroupElapsedTime = e.Stats.GroupElapsedTime, e.Stats.GroupElapsedTime
+		return e.TGID, &s, true
+	}
+
+	if e.Stats.TGID != 0 {
+		// The kernel flags the last task of each process. Any other task,
+		// including a thread group leader which exits before its threads,
+		// is followed by the exit of the last task with the statistics of
+		// the whole process.
+		if e.Stats.TGID != e.PID || e.Stats.Flags&AccountingGroupExited == 0 {
+			return 0, nil, false
+		}
+
+		return e.PID, e.Stats, true
+	}
+
+	// Without a TGID from the kernel, assume the task was a single-threaded
+	// process.
+	return e.PID, e.Stats, true
+}
+
+// An exitSet merges exits into the final statistics of the processes they
+// describe. The zero value is ready to use.
+//
+// The CPU times, page faults and I/O of a multithreaded process are summed
+// from the exits of its threads, so the exits of every thread should be
+// added. Kernels which do not report TGIDs do not identify the threads of a
+// process, so on such kernels only the usage of the last thread is included.
+type exitSet struct {
+	// final contains the final statistics of each exited process, and
+	// whole reports whether they are known to describe the whole process.
+	final map[int]*Stats
+	whole map[int]bool
+
+	// threads contains the summed usage of the exited threads of each
+	// running process.
+	threads map[int]*Stats
+}
+
+// add merges e into the set. ok reports whether e set the final statistics
+// of the process identified by tgid, and first reports whether they were
+// previously unknown.
+//
+// On kernels which do not report TGIDs, the exit of the thread group
+// statistics of a process replaces that of a leader which exited first. Any
+// other exit of a known process is ignored.
+func (x *exitSet) add(e Exit) (tgid int, first, ok bool) {
+	if x.final == nil {
+		x.final = make(map[int]*Stats)
+		x.whole = make(map[int]bool)
+		x.threads = make(map[int]*Stats)
+	}
+
+	if id := e.Stats.TGID; id != 0 {
+		t, ok := x.threads[id]
+		if !ok {
+			t = &Stats{}
+			x.threads[id] = t
+		}
+		t.addUsage(e.Stats)
+	}
+
+	tgid, stats, ok := e.process()
+	if !ok {
+		return 0, false, false
+	}
+
+	if e.TGIDStats != nil {
+		t, ok := x.threads[tgid]
+		if !ok {
+			t = e.Stats
+		}
+		stats.addUsage(t)
+	}
+	delete(x.threads, tgid)
+
+	whole := e.TGIDStats != nil || e.Stats.TGID != 0
+	if _, known := x.final[tgid]; known {
+		if x.whole[tgid] || e.TGIDStats == nil {
+			return 0, false, false
+		}
+
+		x.final[tgid], x.whole[tgid] = stats, whole
+		return tgid, false, true
+	}
+
+	x.final[tgid], x.whole[tgid] = stats, whole
+	return tgid, true, true
+}
+
+// remove forgets the final statistics of the process identified by tgid.
+func (x *exitSet) remove(tgid int) {
+	delete(x.final, tgid)
+	delete(x.whole, tgid)
+}
+
+// An ExitConfig configures an ExitListener. The zero value is valid and
+// listens for exits on all possible CPUs using a single socket.
+type ExitConfig struct {
+	// CPUs specifies the CPUs to monitor for task exits. If nil, all possible
+	// CPUs are monitored, including CPUs which are currently offline, so that
+	// exits on CPUs which are brought online later are not missed. Callers
+	// which only care about the CPUs a process may run on can pass the set
+	// reported by sched_getaffinity(2) instead.
+	CPUs []int
+
+	// Shards specifies the number of sockets used to receive exit
+	// notifications. CPUs are divided into Shards contiguous groups, and each
+	// socket is registered with the kernel for a single group. Values less
+	// than 1 are treated as 1, and values greater than the number of CPUs are
+	// reduced to the number of CPUs.
+	Shards int
+
+	// ReadBuffer, if non-zero, sets the receive buffer size in bytes for
+	// each socket.
+	ReadBuffer int
+
+	// Buffer sets the capacity of the channel returned by
+	// ExitListener.Exits.
+	Buffer int
+}
+
+// An ExitListener receives statistics from the kernel as tasks exit.
+//
+// The kernel recommends that systems with a high rate of task creation
+// spread exit notifications across several sockets, each registered for a
+// subset of CPUs. ExitListener does so when ExitConfig.Shards is greater
+// than 1, and merges the notifications from all sockets into one channel.
+//
+// ExitListener requires elevated privileges.
+type ExitListener struct {
+	l osListener
+}
+
+// ListenExits creates an ExitListener which receives statistics for tasks
+// exiting on the CPUs specified by cfg. If cfg is nil, a default
+// configuration is used.
+func ListenExits(cfg *ExitConfig) (*ExitListener, error) {
+	if cfg == nil {
+		cfg = &ExitConfig{}
+	}
+
+	l, err := newListener(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &ExitListener{
+		l: l,
+	}, nil
+}
+
+// Exits returns a channel which receives an Exit for each task which exits
+// on a monitored CPU.
+//
+// Exits for tasks on the same CPU are delivered in the order the kernel sent
+// them. With more than one shard, exits on CPUs handled by different shards
+// may be delivered out of order, by at most the time taken to receive them,
+// and may be ordered using Exit.Time.
+//
+// The channel is closed when the ExitListener is closed or encounters an
+// error, which is reported by Err.
+func (l *ExitListener) Exits() <-chan Exit {
+	return l.l.Exits()
+}
+
+// Err returns the error which caused the channel returned by Exits to be
+// closed, or nil if the ExitListener was closed normally or is still
+// running.
+func (l *ExitListener) Err() error {
+	return l.l.Err()
+}
+
+// Overruns returns the number of times a socket's receive buffer overflowed
+// and the kernel discarded exit notifications. A steadily increasing value
+// indicates that more shards or a larger ExitConfig.ReadBuffer are needed.
+func (l *ExitListener) Overruns() uint64 {
+	return l.l.Overruns()
+}
+
+// Close releases resources used by an ExitListener.
+func (l *ExitListener) Close() error {
+	return l.l.Close()
+}
+
+// An osListener is the operating system-specific implementation of
+// ExitListener.
+type osListener interface {
+	io.Closer
+	Exits() <-chan Exit
+	Err() error
+	Overruns() uint64
+}
@@ -0,0 +1,387 @@
+//go:build linux
+// +build linux
+
+package taskstats
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+	"golang.org/x/sys/unix"
+)
+
+// possibleCPUs is the sysfs file which lists all CPUs that can ever be
+// brought online.
+const possibleCPUs = "/sys/devices/system/cpu/possible"
+
+var _ osListener = &listener{}
+
+// A listener is a Linux-specific taskstats exit listener.
+type listener struct {
+	shards []*client
+	masks  []string
+	exitC  chan Exit
+
+	wg       sync.WaitGroup
+	done     chan struct{}
+	once     sync.Once
+	err      error
+	overruns atomic.Uint64
+}
+
+// newListener opens one connection to the taskstats family per shard and
+// registers each for exit notifications on its share of CPUs.
+func newListener(cfg *ExitConfig) (*listener, error) {
+	cpus := cfg.CPUs
+	if cpus == nil {
+		b, err := os.ReadFile(possibleCPUs)
+		if err != nil {
+			return nil, err
+		}
+
+		cpus, err = parseCPUList(string(b))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	masks := shardCPUs(cpus, cfg.Shards)
+	if len(masks) == 0 {
+		return nil, errors.New("taskstats: no CPUs specified for exit listener")
+	}
+
+	shards := make([]*client, 0, len(masks))
+	closeAll := func() {
+		for _, s := range shards {
+			_ = s.Close()
+		}
+	}
+
+	for range masks {
+		s, err := newClient()
+		if err != nil {
+			closeAll()
+			return nil, err
+		}
+		shards = append(shards, s)
+
+		if cfg.ReadBuffer != 0 {
+			if err := s.c.SetReadBuffer(cfg.ReadBuffer); err != nil {
+				closeAll()
+				return nil, err
+			}
+		}
+	}
+
+	l, err := initListener(shards, masks, cfg.Buffer)
+	if err != nil {
+		closeAll()
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// initListener is the internal listener constructor used in some tests. Each
+// client in shards is registered for the CPUs in the corresponding element of
+// masks.
+func initListener(shards []*client, masks []string, buffer int) (*listener, error) {
+	for i, s := range shards {
+		if err := s.register(masks[i]); err != nil {
+			return nil, err
+		}
+	}
+
+	l := &listener{
+		shards: shards,
+		masks:  masks,
+		exitC:  make(chan Exit, buffer),
+		done:   make(chan struct{}),
+	}
+
+	l.wg.Add(len(shards))
+	for _, s := range shards {
+		go l.receive(s)
+	}
+
+	// Close the exits channel only once all shards have stopped sending.
+	go func() {
+		l.wg.Wait()
+		close(l.exitC)
+	}()
+
+	return l, nil
+}
+
+// Exits implements osListener.
+func (l *listener) Exits() <-chan Exit { return l.exitC }
+
+// Err implements osListener.
+func (l *listener) Err() error {
+	// err is only written before done is closed.
+	select {
+	case <-l.done:
+		return l.err
+	default:
+		return nil
+	}
+}
+
+// Overruns implements osListener.
+func (l *listener) Overruns() uint64 { return l.overruns.Load() }
+
+// Close implements osListener.
+func (l *listener) Close() error {
+	l.stop(nil)
+	l.wg.Wait()
+	return nil
+}
+
+// stop stops all shards, recording err as the reason if it is the first call.
+func (l *listener) stop(err error) {
+	l.once.Do(func() {
+		l.err = err
+		close(l.done)
+
+		// The kernel only removes listeners for closed sockets when it next
+		// fails to deliver to them. Until then, a socket which reuses the
+		// port ID of a closed one would receive its notifications, so
+		// deregister explicitly.
+		for i, s := range l.shards {
+			_ = s.deregister(l.masks[i])
+			_ = s.Close()
+		}
+	})
+}
+
+// receive receives exit notifications from a single shard until the listener
+// is stopped.
+func (l *listener) receive(s *client) {
+	defer l.wg.Done()
+
+	for {
+		msgs, _, err := s.c.Receive()
+		if err != nil {
+			select {
+			case <-l.done:
+				// Listener closed, ignore the error caused by closing the socket.
+				return
+			default:
+			}
+
+			if errors.Is(err, unix.ENOBUFS) {
+				// The socket fell behind and the kernel dropped messages, but
+				// the socket remains usable.
+				l.overruns.Add(1)
+				continue
+			}
+
+			l.stop(err)
+			return
+		}
+
+		// The kernel sends exits as tasks exit, so the time they are received
+		// orders them across shards.
+		now := time.Now()
+
+		for _, m := range msgs {
+			e, err := parseExit(m)
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					// Not an exit notification.
+					continue
+				}
+
+				l.stop(err)
+				return
+			}
+
+			e.Time = now
+
+			select {
+			case l.exitC <- *e:
+			case <-l.done:
+				return
+			}
+		}
+	}
+}
+
+// register registers c for exit notifications on the CPUs in mask.
+func (c *client) register(mask string) error {
+	attrs := []netlink.Attribute{{
+		Type: unix.TASKSTATS_CMD_ATTR_REGISTER_CPUMASK,
+		Data: nlenc.Bytes(mask),
+	}}
+
+	_, err := c.execute(unix.TASKSTATS_CMD_GET, netlink.Request|netlink.Acknowledge, attrs)
+	return err
+}
+
+// deregister deregisters c for exit notifications on the CPUs in mask. The
+// request is not acknowledged, as the acknowledgement would race with
+// receiving exit notifications.
+func (c *client) deregister(mask string) error {
+	b, err := netlink.MarshalAttributes([]netlink.Attribute{{
+		Type: unix.TASKSTATS_CMD_ATTR_DEREGISTER_CPUMASK,
+		Data: nlenc.Bytes(mask),
+	}})
+	if err != nil {
+		return err
+	}
+
+	_, err = c.c.Send(genetlink.Message{
+		Header: genetlink.Header{
+			Command: unix.TASKSTATS_CMD_GET,
+			Version: unix.TASKSTATS_VERSION,
+		},
+		Data: b,
+	}, c.family.ID, netlink.Request)
+	return err
+}
+
+// parseExit attempts to parse an Exit structure from a generic netlink message.
+func parseExit(m genetlink.Message) (*Exit, error) {
+	attrs, err := netlink.UnmarshalAttributes(m.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	// On thread group exit, the kernel sends both the PID and TGID
+	// structures in a single message.
+	var e Exit
+	for _, a := range attrs {
+		switch a.Type {
+		case unix.TASKSTATS_TYPE_AGGR_PID:
+			e.PID, e.Stats, err = parseAggr(a.Data, unix.TASKSTATS_TYPE_PID)
+		case unix.TASKSTATS_TYPE_AGGR_TGID:
+			e.TGID, e.TGIDStats, err = parseAggr(a.Data, unix.TASKSTATS_TYPE_TGID)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if e.Stats == nil {
+		// No exit notification found.
+		return nil, os.ErrNotExist
+	}
+
+	return &e, nil
+}
+
+// parseAggr parses the ID and Stats from an ID+stats structure, where typeID
+// is the attribute type of the ID.
+func parseAggr(b []byte, typeID uint16) (int, *Stats, error) {
+	attrs, err := netlink.UnmarshalAttributes(b)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	var (
+		id    int
+		stats *Stats
+	)
+
+	for _, a := range attrs {
+		switch a.Type {
+		case typeID:
+			id = int(nlenc.Uint32(a.Data))
+		case unix.TASKSTATS_TYPE_STATS:
+			stats, err = unmarshalStats(a.Data)
+			if err != nil {
+				return 0, nil, err
+			}
+		}
+	}
+
+	return id, stats, nil
+}
+
+// shardCPUs divides cpus into at most n contiguous groups of near equal size
+// and returns each group formatted as a kernel CPU list.
+func shardCPUs(cpus []int, n int) []string {
+	cpus = append([]int(nil), cpus...)
+	sort.Ints(cpus)
+
+	if n < 1 {
+		n = 1
+	}
+	if n > len(cpus) {
+		n = len(cpus)
+	}
+
+	masks := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		lo, hi := i*len(cpus)/n, (i+1)*len(cpus)/n
+		masks = append(masks, formatCPUList(cpus[lo:hi]))
+	}
+
+	return masks
+}
+
+// parseCPUList parses a kernel CPU list such as "0-3,8,10-11".
+func parseCPUList(s string) ([]int, error) {
+	var cpus []int
+	for _, r := range strings.Split(strings.TrimSpace(s), ",") {
+		if r == "" {
+			continue
+		}
+
+		lo, hi, ok := strings.Cut(r, "-")
+		first, err := strconv.Atoi(lo)
+		if err != nil {
+			return nil, fmt.Errorf("taskstats: invalid CPU list %q: %v", s, err)
+		}
+
+		last := first
+		if ok {
+			last, err = strconv.Atoi(hi)
+			if err != nil {
+				return nil, fmt.Errorf("taskstats: invalid CPU list %q: %v", s, err)
+			}
+		}
+
+		for cpu := first; cpu <= last; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+
+	return cpus, nil
+}
+
+// formatCPUList formats sorted cpus as a kernel CPU list, collapsing
+// consecutive CPUs into ranges.
+func formatCPUList(cpus []int) string {
+	var sb strings.Builder
+	for i := 0; i < len(cpus); i++ {
+		j := i
+		for j+1 < len(cpus) && cpus[j+1] == cpus[j]+1 {
+			j++
+		}
+
+		if sb.Len() > 0 {
+			sb.WriteByte(',')
+		}
+
+		sb.WriteString(strconv.Itoa(cpus[i]))
+		if j > i {
+			sb.WriteByte('-')
+			sb.WriteString(strconv.Itoa(cpus[j]))
+		}
+
+		i = j
+	}
+
+	return sb.String()
+}
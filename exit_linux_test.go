@@ -0,0 +1,417 @@
+//go:build linux
+// +build linux
+
+package taskstats
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+	"unsafe"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+	"github.com/mdlayher/netlink/nltest"
+	"golang.org/x/sys/unix"
+)
+
+// leaderExitsFirstEnv, when set, makes the test binary run as a
+// multithreaded process whose thread group leader exits before its other
+// threads.
+const leaderExitsFirstEnv = "TASKSTATS_TEST_LEADER_EXITS_FIRST"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(leaderExitsFirstEnv) != "" {
+		leaderExitsFirst()
+	}
+
+	os.Exit(m.Run())
+}
+
+// leaderExitsFirst exits the main thread, which is the thread group leader,
+// while another thread keeps running and later exits the process.
+func leaderExitsFirst() {
+	// The exited main thread keeps its P, so another is needed to run the
+	// remaining thread.
+	runtime.GOMAXPROCS(max(2, runtime.GOMAXPROCS(0)))
+
+	started := make(chan struct{})
+	go func() {
+		runtime.LockOSThread()
+		close(started)
+
+		time.Sleep(100 * time.Millisecond)
+		os.Exit(0)
+	}()
+
+	<-started
+	runtime.LockOSThread()
+	_, _, _ = unix.RawSyscall(unix.SYS_EXIT, 0, 0, 0)
+}
+
+func TestLinuxExitLeaderExitsFirst(t *testing.T) {
+	l, err := ListenExits(nil)
+	if err != nil {
+		if os.IsPermission(err) {
+			t.Skipf("taskstats requires elevated permission: %v", err)
+		}
+
+		t.Fatalf("failed to listen for exits: %v", err)
+	}
+	defer l.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), leaderExitsFirstEnv+"=1")
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("failed to run command: %v", err)
+	}
+	pid := cmd.Process.Pid
+
+	// Gather the exits of every thread of the process, ending with the
+	// thread group statistics.
+	var exits []Exit
+	timer := time.NewTimer(5 * time.Second)
+	defer timer.Stop()
+
+	for done := false; !done; {
+		select {
+		case e := <-l.Exits():
+			if e.Stats.TGID != pid && e.PID != pid {
+				continue
+			}
+
+			exits = append(exits, e)
+			done = e.TGIDStats != nil
+		case <-timer.C:
+			t.Fatalf("timed out waiting for exits of PID %d: %d received", pid, len(exits))
+		}
+	}
+
+	if exits[0].Stats.TGID == 0 {
+		t.Skip("kernel does not report TGIDs")
+	}
+
+	var processes []*Stats
+	for _, e := range exits {
+		if _, stats, ok := e.process(); ok {
+			processes = append(processes, stats)
+		}
+	}
+
+	// Only the exit of the last thread describes the process.
+	last := exits[len(exits)-1]
+	if diff := cmp.Diff(1, len(processes)); diff != "" {
+		t.Fatalf("unexpected number of process exits (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(last.TGIDStats.CPUDelayCount, processes[0].CPUDelayCount); diff != "" {
+		t.Fatalf("unexpected process CPU delay count (-want +got):\n%s", diff)
+	}
+
+	tree, err := buildTree(os.Getpid(), map[int]int{os.Getpid(): 0}, exits, func(tgid int) (*Stats, error) {
+		return &Stats{PID: tgid}, nil
+	})
+	if err != nil {
+		t.Fatalf("failed to build tree: %v", err)
+	}
+
+	if diff := cmp.Diff(1, len(tree.Children)); diff != "" {
+		t.Fatalf("unexpected number of children (-want +got):\n%s", diff)
+	}
+}
+
+func TestLinuxListenerExits(t *testing.T) {
+	var (
+		mu                       sync.Mutex
+		registered, deregistered string
+		receives                 int
+	)
+
+	fn := func(greq genetlink.Message, _ netlink.Message) ([]genetlink.Message, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if greq.Header.Command == unix.TASKSTATS_CMD_GET {
+			attrs, err := netlink.UnmarshalAttributes(greq.Data)
+			if err != nil {
+				t.Fatalf("failed to unmarshal netlink attributes: %v", err)
+			}
+
+			switch attrs[0].Type {
+			case unix.TASKSTATS_CMD_ATTR_REGISTER_CPUMASK:
+				registered = nlenc.String(attrs[0].Data)
+
+				// Acknowledgement.
+				return []genetlink.Message{{}}, nil
+			case unix.TASKSTATS_CMD_ATTR_DEREGISTER_CPUMASK:
+				deregistered = nlenc.String(attrs[0].Data)
+				return nil, nil
+			default:
+				t.Fatalf("unexpected netlink attribute type: %d", attrs[0].Type)
+			}
+		}
+
+		// Multicast receive: deliver two exits, report an overrun, and then
+		// fail permanently.
+		receives++
+		switch receives {
+		case 1:
+			return []genetlink.Message{exitMessage(10), exitMessage(11)}, nil
+		case 2:
+			return nil, unix.ENOBUFS
+		case 3:
+			return []genetlink.Message{exitMessage(12)}, nil
+		default:
+			return nil, unix.EBADF
+		}
+	}
+
+	c := testClient(t, fn)
+
+	l, err := initListener([]*client{c}, []string{"0-3"}, 0)
+	if err != nil {
+		t.Fatalf("failed to create listener: %v", err)
+	}
+	defer l.Close()
+
+	if diff := cmp.Diff("0-3", registered); diff != "" {
+		t.Fatalf("unexpected registered CPU mask (-want +got):\n%s", diff)
+	}
+
+	var pids []int
+	for e := range l.Exits() {
+		if e.Time.IsZero() {
+			t.Fatalf("exit of PID %d has no receive time", e.PID)
+		}
+
+		pids = append(pids, e.PID)
+	}
+
+	if diff := cmp.Diff([]int{10, 11, 12}, pids); diff != "" {
+		t.Fatalf("unexpected exit PIDs (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(uint64(1), l.Overruns()); diff != "" {
+		t.Fatalf("unexpected number of overruns (-want +got):\n%s", diff)
+	}
+
+	if err := l.Err(); !errors.Is(err, unix.EBADF) {
+		t.Fatalf("expected EBADF, but got: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if diff := cmp.Diff("0-3", deregistered); diff != "" {
+		t.Fatalf("unexpected deregistered CPU mask (-want +got):\n%s", diff)
+	}
+}
+
+func TestParseExit(t *testing.T) {
+	tests := []struct {
+		name  string
+		attrs []netlink.Attribute
+		exit  *Exit
+	}{
+		{
+			name:  "no aggr+pid",
+			attrs: []netlink.Attribute{{Type: unix.TASKSTATS_TYPE_NULL}},
+		},
+		{
+			name: "no stats",
+			attrs: []netlink.Attribute{{
+				Type: unix.TASKSTATS_TYPE_AGGR_PID,
+				Data: nltest.MustMarshalAttributes([]netlink.Attribute{{
+					Type: unix.TASKSTATS_TYPE_PID,
+					Data: nlenc.Uint32Bytes(1),
+				}}),
+			}},
+		},
+		{
+			name: "thread",
+			attrs: []netlink.Attribute{
+				aggrAttribute(unix.TASKSTATS_TYPE_AGGR_PID, unix.TASKSTATS_TYPE_PID, 2),
+			},
+			exit: &Exit{
+				PID:   2,
+				Stats: &Stats{PID: 2, BeginTime: time.Unix(2, 0), GroupElapsedTime: 2 * time.Microsecond},
+			},
+		},
+		{
+			name: "thread group",
+			attrs: []netlink.Attribute{
+				aggrAttribute(unix.TASKSTATS_TYPE_AGGR_PID, unix.TASKSTATS_TYPE_PID, 3),
+				aggrAttribute(unix.TASKSTATS_TYPE_AGGR_TGID, unix.TASKSTATS_TYPE_TGID, 1),
+			},
+			exit: &Exit{
+				PID:       3,
+				Stats:     &Stats{PID: 3, BeginTime: time.Unix(3, 0), GroupElapsedTime: 3 * time.Microsecond},
+				TGID:      1,
+				TGIDStats: &Stats{PID: 1, BeginTime: time.Unix(1, 0), GroupElapsedTime: 1 * time.Microsecond},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e, err := parseExit(genetlink.Message{
+				Data: nltest.MustMarshalAttributes(tt.attrs),
+			})
+			if tt.exit == nil {
+				if !os.IsNotExist(err) {
+					t.Fatalf("expected is not exist, but got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to parse exit: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.exit, e); diff != "" {
+				t.Fatalf("unexpected exit (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestShardCPUs(t *testing.T) {
+	tests := []struct {
+		name   string
+		cpus   []int
+		shards int
+		masks  []string
+	}{
+		{
+			name:  "no CPUs",
+			masks: []string{},
+		},
+		{
+			name:  "one shard",
+			cpus:  []int{0, 1, 2, 3},
+			masks: []string{"0-3"},
+		},
+		{
+			name:   "even",
+			cpus:   []int{0, 1, 2, 3, 4, 5, 6, 7},
+			shards: 4,
+			masks:  []string{"0-1", "2-3", "4-5", "6-7"},
+		},
+		{
+			name:   "uneven",
+			cpus:   []int{0, 1, 2, 3, 4},
+			shards: 2,
+			masks:  []string{"0-1", "2-4"},
+		},
+		{
+			name:   "sparse unsorted",
+			cpus:   []int{9, 0, 2, 8, 1},
+			shards: 2,
+			masks:  []string{"0-1", "2,8-9"},
+		},
+		{
+			name:   "more shards than CPUs",
+			cpus:   []int{0, 1},
+			shards: 8,
+			masks:  []string{"0", "1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if diff := cmp.Diff(tt.masks, shardCPUs(tt.cpus, tt.shards)); diff != "" {
+				t.Fatalf("unexpected CPU masks (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseCPUList(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		cpus []int
+		ok   bool
+	}{
+		{
+			name: "single",
+			s:    "0\n",
+			cpus: []int{0},
+			ok:   true,
+		},
+		{
+			name: "ranges",
+			s:    "0-3,8,10-11\n",
+			cpus: []int{0, 1, 2, 3, 8, 10, 11},
+			ok:   true,
+		},
+		{
+			name: "bad start",
+			s:    "x-3",
+		},
+		{
+			name: "bad end",
+			s:    "0-x",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cpus, err := parseCPUList(tt.s)
+			if tt.ok && err != nil {
+				t.Fatalf("failed to parse CPU list: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("an error was expected, but none occurred")
+			}
+
+			if diff := cmp.Diff(tt.cpus, cpus); diff != "" {
+				t.Fatalf("unexpected CPUs (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// exitMessage creates an exit notification message for pid.
+func exitMessage(pid int) genetlink.Message {
+	return genetlink.Message{
+		Header: genetlink.Header{
+			Command: unix.TASKSTATS_CMD_NEW,
+		},
+		Data: nltest.MustMarshalAttributes([]netlink.Attribute{
+			aggrAttribute(unix.TASKSTATS_TYPE_AGGR_PID, unix.TASKSTATS_TYPE_PID, pid),
+		}),
+	}
+}
+
+// aggrAttribute creates an ID+stats attribute of type typeAggr, containing an
+// ID attribute of type typeID.
+func aggrAttribute(typeAggr, typeID uint16, id int) netlink.Attribute {
+	stats := unix.Taskstats{
+		Version:    unix.TASKSTATS_VERSION,
+		Ac_pid:     uint32(id),
+		Ac_btime:   uint32(id),
+		Ac_tgetime: uint64(id),
+	}
+
+	// Cast unix.Taskstats structure into a byte array with the correct size.
+	b := *(*[sizeofTaskstats]byte)(unsafe.Pointer(&stats))
+
+	return netlink.Attribute{
+		Type: typeAggr,
+		Data: nltest.MustMarshalAttributes([]netlink.Attribute{
+			{
+				Type: typeID,
+				Data: nlenc.Uint32Bytes(uint32(id)),
+			},
+			{
+				Type: unix.TASKSTATS_TYPE_STATS,
+				Data: b[:],
+			},
+		}),
+	}
+}
@@ -0,0 +1,34 @@
+//go:build !linux
+// +build !linux
+
+package taskstats
+
+var _ osListener = &listener{}
+
+// A listener is an unimplemented taskstats exit listener.
+type listener struct{}
+
+// newListener always returns an error.
+func newListener(_ *ExitConfig) (*listener, error) {
+	return nil, errUnimplemented
+}
+
+// Close implements osListener.
+func (l *listener) Close() error {
+	return errUnimplemented
+}
+
+// Exits implements osListener.
+func (l *listener) Exits() <-chan Exit {
+	return nil
+}
+
+// Err implements osListener.
+func (l *listener) Err() error {
+	return errUnimplemented
+}
+
+// Overruns implements osListener.
+func (l *listener) Overruns() uint64 {
+	return 0
+}
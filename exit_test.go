@@ -0,0 +1,181 @@
+package taskstats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestExitProcess(t *testing.T) {
+	tests := []struct {
+		name  string
+		e     Exit
+		tgid  int
+		stats *Stats
+		ok    bool
+	}{
+		{
+			name:  "no TGID",
+			e:     Exit{PID: 1, Stats: &Stats{PID: 1, UserCPUTime: time.Second}},
+			tgid:  1,
+			stats: &Stats{PID: 1, UserCPUTime: time.Second},
+			ok:    true,
+		},
+		{
+			name: "single-threaded",
+			e: Exit{PID: 1, Stats: &Stats{
+				PID:   1,
+				TGID:  1,
+				Flags: AccountingGroupExited,
+			}},
+			tgid:  1,
+			stats: &Stats{PID: 1, TGID: 1, Flags: AccountingGroupExited},
+			ok:    true,
+		},
+		{
+			name: "thread",
+			e:    Exit{PID: 2, Stats: &Stats{PID: 2, TGID: 1}},
+		},
+		{
+			name: "leader exits first",
+			e:    Exit{PID: 1, Stats: &Stats{PID: 1, TGID: 1, CPUDelayCount: 97}},
+		},
+		{
+			name: "last thread",
+			e: Exit{
+				PID: 2,
+				Stats: &Stats{
+					PID:              2,
+					PPID:             3,
+					TGID:             1,
+					Comm:             "foo",
+					Flags:            AccountingGroupExited,
+					BeginTime:        time.Unix(101, 0),
+					ElapsedTime:      1500 * time.Millisecond,
+					GroupElapsedTime: 3200 * time.Millisecond,
+					UserCPUTime:      time.Second,
+				},
+				TGID:      1,
+				TGIDStats: &Stats{ElapsedTime: 7 * time.Second, CPUDelayCount: 193},
+			},
+			tgid: 1,
+			stats: &Stats{
+				PID:   1,
+				PPID:  3,
+				TGID:  1,
+				Comm:  "foo",
+				Flags: AccountingGroupExited,
+				// The leader started when the last thread had been running
+				// for 1s, to the second, of the 3s the process ran.
+				BeginTime:        time.Unix(99, 0),
+				ElapsedTime:      3200 * time.Millisecond,
+				GroupElapsedTime: 3200 * time.Millisecond,
+				CPUDelayCount:    193,
+			},
+			ok: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tgid, stats, ok := tt.e.process()
+			if diff := cmp.Diff(tt.ok, ok); diff != "" {
+				t.Fatalf("unexpected ok (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.tgid, tgid); diff != "" {
+				t.Fatalf("unexpected TGID (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.stats, stats); diff != "" {
+				t.Fatalf("unexpected stats (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestExitSet(t *testing.T) {
+	type result struct {
+		TGID      int
+		First, OK bool
+	}
+
+	tests := []struct {
+		name    string
+		exits   []Exit
+		results []result
+		final   map[int]*Stats
+	}{
+		{
+			name: "threads",
+			exits: []Exit{
+				{PID: 1, Stats: &Stats{PID: 1, TGID: 1, UserCPUTime: time.Second, MinorPageFaults: 1}},
+				{PID: 2, Stats: &Stats{PID: 2, TGID: 1, ReadBytes: 2, MinorPageFaults: 2}},
+				{
+					PID:       3,
+					Stats:     &Stats{PID: 3, TGID: 1, Flags: AccountingGroupExited, SystemCPUTime: time.Second},
+					TGID:      1,
+					TGIDStats: &Stats{CPUDelayCount: 3},
+				},
+				{PID: 4, Stats: &Stats{PID: 4, TGID: 4, Flags: AccountingGroupExited, WriteBytes: 4}},
+				// Duplicate.
+				{PID: 4, Stats: &Stats{PID: 4, TGID: 4, Flags: AccountingGroupExited}},
+			},
+			results: []result{{}, {}, {TGID: 1, First: true, OK: true}, {TGID: 4, First: true, OK: true}, {}},
+			final: map[int]*Stats{
+				1: {
+					PID:             1,
+					TGID:            1,
+					Flags:           AccountingGroupExited,
+					UserCPUTime:     time.Second,
+					SystemCPUTime:   time.Second,
+					MinorPageFaults: 3,
+					ReadBytes:       2,
+					CPUDelayCount:   3,
+				},
+				4: {PID: 4, TGID: 4, Flags: AccountingGroupExited, WriteBytes: 4},
+			},
+		},
+		{
+			name: "no TGIDs",
+			exits: []Exit{
+				{PID: 1, Stats: &Stats{PID: 1, UserCPUTime: time.Second}},
+				{
+					PID:       2,
+					Stats:     &Stats{PID: 2, SystemCPUTime: time.Second},
+					TGID:      1,
+					TGIDStats: &Stats{CPUDelayCount: 2},
+				},
+				// Duplicate.
+				{PID: 1, Stats: &Stats{PID: 1}},
+			},
+			results: []result{{TGID: 1, First: true, OK: true}, {TGID: 1, OK: true}, {}},
+			final: map[int]*Stats{
+				// Only the usage of the last thread is known.
+				1: {PID: 1, TGID: 1, SystemCPUTime: time.Second, CPUDelayCount: 2},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				x       exitSet
+				results []result
+			)
+			for _, e := range tt.exits {
+				tgid, first, ok := x.add(e)
+				results = append(results, result{TGID: tgid, First: first, OK: ok})
+			}
+
+			if diff := cmp.Diff(tt.results, results); diff != "" {
+				t.Fatalf("unexpected results (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(tt.final, x.final); diff != "" {
+				t.Fatalf("unexpected final statistics (-want +got):\n%s", diff)
+			}
+			if diff := cmp.Diff(0, len(x.threads)); diff != "" {
+				t.Fatalf("unexpected threads of exited processes (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"time"
+)
+
+// csvFields are the columns written by a CSVWriter before the metric columns,
+// which identify a task and describe how it ran.
+var csvFields = []struct {
+	name  string
+	value func(s Sample) string
+}{
+	{"time", func(s Sample) string { return csvTime(s.Time) }},
+	{"cgroup", func(s Sample) string { return s.CGroup }},
+	{"pid", func(s Sample) string { return strconv.Itoa(s.PID) }},
+	{"ppid", func(s Sample) string { return strconv.Itoa(s.Stats.PPID) }},
+	{"tgid", func(s Sample) string { return strconv.Itoa(s.TGID) }},
+	{"uid", func(s Sample) string { return strconv.FormatUint(uint64(s.Stats.UID), 10) }},
+	{"gid", func(s Sample) string { return strconv.FormatUint(uint64(s.Stats.GID), 10) }},
+	{"comm", func(s Sample) string { return s.Stats.Comm }},
+	{"exit_code", func(s Sample) string { return strconv.FormatUint(uint64(s.Stats.ExitCode), 10) }},
+	{"flags", func(s Sample) string { return strconv.FormatUint(uint64(s.Stats.Flags), 10) }},
+	{"begin_time", func(s Sample) string { return csvTime(s.Stats.BeginTime) }},
+	{"no_delays", func(s Sample) string { return strconv.FormatBool(s.Stats.NoDelays) }},
+}
+
+// A CSVWriter writes Stats as comma-separated values, one row per sample, for
+// loading into spreadsheets and data processing tools.
+//
+// The first call to Write writes a header row naming each column. The
+// identifying fields of each sample and its Stats come first, followed by
+// each statistic using the names written by WriteInflux, and then a column
+// with a "_delta" suffix for each counter, containing its value in the
+// sample's Delta.
+//
+// Times are written in RFC 3339 format, durations in floating point seconds,
+// and counts and sizes as integers. Empty cells denote unknown values: times
+// which were not reported, delay statistics for Stats lacking delay
+// accounting, and deltas for samples without a Delta, such as the first
+// sample of a process collected by a taskstats.Collector.
+type CSVWriter struct {
+	// Comma is the field delimiter, set before the first call to Write. If
+	// zero, a comma is used. Set Comma to '\t' to write tab-separated values.
+	Comma rune
+
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+// NewCSVWriter creates a CSVWriter which writes to w.
+func NewCSVWriter(w io.Writer) *CSVWriter {
+	return &CSVWriter{w: csv.NewWriter(w)}
+}
+
+// Write writes a row for each sample which contains Stats. Samples without
+// Stats are skipped.
+func (w *CSVWriter) Write(samples []Sample) error {
+	if w.Comma != 0 {
+		w.w.Comma = w.Comma
+	}
+
+	if !w.wroteHeader {
+		if err := w.w.Write(csvHeader()); err != nil {
+			return err
+		}
+		w.wroteHeader = true
+	}
+
+	for _, s := range samples {
+		st := s.Stats
+		if st == nil {
+			continue
+		}
+
+		row := make([]string, 0, len(csvFields)+2*len(statsMetrics))
+		for _, f := range csvFields {
+			row = append(row, f.value(s))
+		}
+
+		for _, m := range statsMetrics {
+			if m.delay && st.NoDelays {
+				row = append(row, "")
+				continue
+			}
+
+			row = append(row, csvValue(m.value(st)))
+		}
+
+		for _, m := range statsMetrics {
+			if m.kind != counter {
+				continue
+			}
+
+			if s.Delta == nil || m.delay && s.Delta.NoDelays {
+				row = append(row, "")
+				continue
+			}
+
+			row = append(row, csvValue(m.value(s.Delta)))
+		}
+
+		if err := w.w.Write(row); err != nil {
+			return err
+		}
+	}
+
+	w.w.Flush()
+	return w.w.Error()
+}
+
+// csvHeader returns the header row written by a CSVWriter.
+func csvHeader() []string {
+	var header []string
+	for _, f := range csvFields {
+		header = append(header, f.name)
+	}
+
+	for _, m := range statsMetrics {
+		header = append(header, m.name)
+	}
+
+	for _, m := range statsMetrics {
+		if m.kind == counter {
+			header = append(header, m.name+"_delta")
+		}
+	}
+
+	return header
+}
+
+// csvValue formats v for a CSV cell.
+func csvValue(v value) string {
+	if v.isFloat {
+		return strconv.FormatFloat(v.f, 'f', -1, 64)
+	}
+
+	return strconv.FormatUint(v.i, 10)
+}
+
+// csvTime formats t for a CSV cell, or returns an empty cell if t is unset.
+func csvTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.Format(time.RFC3339Nano)
+}
@@ -0,0 +1,243 @@
+// Package export encodes taskstats statistics in text formats understood by
+// common metrics and data processing systems, without depending on their
+// client libraries.
+package export
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/mdlayher/taskstats"
+)
+
+// A Sample is a set of statistics to be exported, and the labels which
+// identify them. Stats, CGroupStats, or both may be set.
+type Sample struct {
+	// Time is when the statistics were collected. If zero, no timestamp is
+	// written, and the receiving system assigns one.
+	Time time.Time
+
+	// TGID and PID, if non-zero, label the sample with the process and
+	// thread described by Stats. Thread group statistics carry no
+	// identifiers of their own, so TGID must be set to identify them.
+	TGID, PID int
+
+	// CGroup, if not empty, labels the sample with a cgroup path.
+	CGroup string
+
+	// Stats contains task statistics, which are labeled with the command
+	// name of the task when it is known.
+	//
+	// Stats should describe a thread or a whole process, such as those
+	// reported by taskstats.Client.Process. The kernel's thread group
+	// statistics reported by taskstats.Client.TGID omit CPU time, page
+	// faults and I/O, which would be exported as zero.
+	Stats *taskstats.Stats
+
+	// Delta, if set, contains the change in Stats since the previous sample
+	// of the same task, such as that computed by a taskstats.Collector.
+	Delta *taskstats.Stats
+
+	// CGroupStats contains cgroup statistics.
+	CGroupStats *taskstats.CGroupStats
+}
+
+// FromCollector converts samples collected by a taskstats.Collector into
+// Samples identified by their TGIDs, including their deltas.
+func FromCollector(samples []taskstats.Sample) []Sample {
+	ss := make([]Sample, 0, len(samples))
+	for _, s := range samples {
+		ss = append(ss, Sample{
+			Time:  s.Time,
+			TGID:  s.TGID,
+			Stats: s.Stats,
+			Delta: s.Delta,
+		})
+	}
+
+	return ss
+}
+
+// A label is a name/value pair which identifies a sample.
+type label struct {
+	name, value string
+}
+
+// labels returns the labels of s, ordered by name.
+func (s Sample) labels() []label {
+	var ls []label
+	if s.CGroup != "" {
+		ls = append(ls, label{"cgroup", s.CGroup})
+	}
+
+	if st := s.Stats; st != nil {
+		if st.Comm != "" {
+			ls = append(ls, label{"comm", st.Comm})
+		}
+	}
+
+	if s.PID != 0 {
+		ls = append(ls, label{"pid", strconv.Itoa(s.PID)})
+	}
+	if s.TGID != 0 {
+		ls = append(ls, label{"tgid", strconv.Itoa(s.TGID)})
+	}
+
+	sort.Slice(ls, func(i, j int) bool {
+		return ls[i].name < ls[j].name
+	})
+
+	return ls
+}
+
+// A kind is the kind of a metric.
+type kind int
+
+// Possible kind values.
+const (
+	counter kind = iota
+	gauge
+)
+
+// A value is a numeric metric value, which is either an integer or a
+// floating point number.
+type value struct {
+	isFloat bool
+	i       uint64
+	f       float64
+}
+
+// seconds creates a floating point value from d in seconds.
+func seconds(d time.Duration) value {
+	return value{isFloat: true, f: d.Seconds()}
+}
+
+// integer creates an integer value.
+func integer(i uint64) value {
+	return value{i: i}
+}
+
+// A statsMetric describes a metric derived from taskstats.Stats.
+type statsMetric struct {
+	// name is the field name, and unit is the metric unit, if any.
+	name, unit, help string
+	kind             kind
+
+	// delay reports whether the metric is a delay accounting statistic,
+	// which is omitted when delays are unavailable.
+	delay bool
+
+	value func(s *taskstats.Stats) value
+}
+
+// statsMetrics describes the metrics derived from taskstats.Stats.
+var statsMetrics = []statsMetric{
+	{
+		name: "elapsed_seconds", unit: "seconds", kind: counter,
+		help:  "Wall clock time elapsed since the process or thread started.",
+		value: func(s *taskstats.Stats) value { return seconds(s.ElapsedTime) },
+	},
+	{
+		name: "user_cpu_seconds", unit: "seconds", kind: counter,
+		help:  "CPU time spent running in user mode.",
+		value: func(s *taskstats.Stats) value { return seconds(s.UserCPUTime) },
+	},
+	{
+		name: "system_cpu_seconds", unit: "seconds", kind: counter,
+		help:  "CPU time spent running in kernel mode.",
+		value: func(s *taskstats.Stats) value { return seconds(s.SystemCPUTime) },
+	},
+	{
+		name: "minor_page_faults", kind: counter,
+		help:  "Page faults which did not require loading a page from disk.",
+		value: func(s *taskstats.Stats) value { return integer(s.MinorPageFaults) },
+	},
+	{
+		name: "major_page_faults", kind: counter,
+		help:  "Page faults which required loading a page from disk.",
+		value: func(s *taskstats.Stats) value { return integer(s.MajorPageFaults) },
+	},
+	{
+		name: "cpu_delays", kind: counter, delay: true,
+		help:  "Number of times the task waited for a CPU while runnable.",
+		value: func(s *taskstats.Stats) value { return integer(s.CPUDelayCount) },
+	},
+	{
+		name: "cpu_delay_seconds", unit: "seconds", kind: counter, delay: true,
+		help:  "Time spent waiting for a CPU while runnable.",
+		value: func(s *taskstats.Stats) value { return seconds(s.CPUDelay) },
+	},
+	{
+		name: "block_io_delays", kind: counter, delay: true,
+		help:  "Number of times the task waited for synchronous block I/O to complete.",
+		value: func(s *taskstats.Stats) value { return integer(s.BlockIODelayCount) },
+	},
+	{
+		name: "block_io_delay_seconds", unit: "seconds", kind: counter, delay: true,
+		help:  "Time spent waiting for synchronous block I/O to complete.",
+		value: func(s *taskstats.Stats) value { return seconds(s.BlockIODelay) },
+	},
+	{
+		name: "swap_in_delays", kind: counter, delay: true,
+		help:  "Number of times the task waited for pages to be swapped in.",
+		value: func(s *taskstats.Stats) value { return integer(s.SwapInDelayCount) },
+	},
+	{
+		name: "swap_in_delay_seconds", unit: "seconds", kind: counter, delay: true,
+		help:  "Time spent waiting for pages to be swapped in.",
+		value: func(s *taskstats.Stats) value { return seconds(s.SwapInDelay) },
+	},
+	{
+		name: "free_pages_delays", kind: counter, delay: true,
+		help:  "Number of times the task waited for memory reclaim.",
+		value: func(s *taskstats.Stats) value { return integer(s.FreePagesDelayCount) },
+	},
+	{
+		name: "free_pages_delay_seconds", unit: "seconds", kind: counter, delay: true,
+		help:  "Time spent waiting for memory reclaim.",
+		value: func(s *taskstats.Stats) value { return seconds(s.FreePagesDelay) },
+	},
+	{
+		name: "thrashing_delays", kind: counter, delay: true,
+		help:  "Number of times the task waited for thrashing pages to be read.",
+		value: func(s *taskstats.Stats) value { return integer(s.ThrashingDelayCount) },
+	},
+	{
+		name: "thrashing_delay_seconds", unit: "seconds", kind: counter, delay: true,
+		help:  "Time spent waiting for thrashing pages to be read.",
+		value: func(s *taskstats.Stats) value { return seconds(s.ThrashingDelay) },
+	},
+	{
+		name: "read_bytes", unit: "bytes", kind: counter,
+		help:  "Bytes the task caused to be read from storage.",
+		value: func(s *taskstats.Stats) value { return integer(s.ReadBytes) },
+	},
+	{
+		name: "write_bytes", unit: "bytes", kind: counter,
+		help:  "Bytes the task caused to be written to storage.",
+		value: func(s *taskstats.Stats) value { return integer(s.WriteBytes) },
+	},
+	{
+		name: "peak_rss_bytes", unit: "bytes", kind: gauge,
+		help:  "Peak resident set size of the task's address space.",
+		value: func(s *taskstats.Stats) value { return integer(s.PeakRSS) },
+	},
+	{
+		name: "peak_virtual_memory_bytes", unit: "bytes", kind: gauge,
+		help:  "Peak virtual memory size of the task's address space.",
+		value: func(s *taskstats.Stats) value { return integer(s.PeakVirtualMemory) },
+	},
+}
+
+// cgroupStates are the task states counted by taskstats.CGroupStats.
+var cgroupStates = []struct {
+	name  string
+	value func(cs *taskstats.CGroupStats) uint64
+}{
+	{"sleeping", func(cs *taskstats.CGroupStats) uint64 { return cs.Sleeping }},
+	{"running", func(cs *taskstats.CGroupStats) uint64 { return cs.Running }},
+	{"stopped", func(cs *taskstats.CGroupStats) uint64 { return cs.Stopped }},
+	{"uninterruptible", func(cs *taskstats.CGroupStats) uint64 { return cs.Uninterruptible }},
+	{"io_wait", func(cs *taskstats.CGroupStats) uint64 { return cs.IOWait }},
+}
@@ -0,0 +1,218 @@
+package export_test
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/taskstats"
+	"github.com/mdlayher/taskstats/export"
+)
+
+// testSamples returns samples covering both kinds of statistics, labels
+// which require escaping, and statistics lacking delay accounting.
+func testSamples() []export.Sample {
+	return []export.Sample{
+		{
+			Time:   time.Unix(1700000000, 500000000),
+			TGID:   10,
+			PID:    10,
+			CGroup: "/system.slice/my app.service",
+			Stats: &taskstats.Stats{
+				PID:             10,
+				TGID:            10,
+				Comm:            `a"b`,
+				UserCPUTime:     1500 * time.Millisecond,
+				MajorPageFaults: 2,
+				CPUDelayCount:   3,
+				CPUDelay:        250 * time.Millisecond,
+				PeakRSS:         4096,
+			},
+			CGroupStats: &taskstats.CGroupStats{Sleeping: 4, Running: 1},
+		},
+		{
+			PID: 11,
+			Stats: &taskstats.Stats{
+				PID:      11,
+				Comm:     "sh",
+				NoDelays: true,
+			},
+		},
+	}
+}
+
+func TestWriteInflux(t *testing.T) {
+	var b bytes.Buffer
+	if err := export.WriteInflux(&b, testSamples()); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	want := `taskstats,cgroup=/system.slice/my\ app.service,comm=a"b,pid=10,tgid=10 ` +
+		`elapsed_seconds=0,user_cpu_seconds=1.5,system_cpu_seconds=0,minor_page_faults=0i,major_page_faults=2i,` +
+		`cpu_delays=3i,cpu_delay_seconds=0.25,block_io_delays=0i,block_io_delay_seconds=0,` +
+		`swap_in_delays=0i,swap_in_delay_seconds=0,free_pages_delays=0i,free_pages_delay_seconds=0,` +
+		`thrashing_delays=0i,thrashing_delay_seconds=0,read_bytes=0i,write_bytes=0i,peak_rss_bytes=4096i,peak_virtual_memory_bytes=0i 1700000000500000000
+cgroupstats,cgroup=/system.slice/my\ app.service,comm=a"b,pid=10,tgid=10 ` +
+		`sleeping=4i,running=1i,stopped=0i,uninterruptible=0i,io_wait=0i 1700000000500000000
+taskstats,comm=sh,pid=11 elapsed_seconds=0,user_cpu_seconds=0,system_cpu_seconds=0,` +
+		`minor_page_faults=0i,major_page_faults=0i,read_bytes=0i,write_bytes=0i,peak_rss_bytes=0i,peak_virtual_memory_bytes=0i
+`
+
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Fatalf("unexpected line protocol (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriteInfluxClamp(t *testing.T) {
+	var b bytes.Buffer
+	err := export.WriteInflux(&b, []export.Sample{{
+		CGroup:      "/",
+		CGroupStats: &taskstats.CGroupStats{Sleeping: math.MaxUint64},
+	}})
+	if err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	want := "cgroupstats,cgroup=/ sleeping=9223372036854775807i,running=0i,stopped=0i,uninterruptible=0i,io_wait=0i\n"
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Fatalf("unexpected line protocol (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriteOpenMetrics(t *testing.T) {
+	var b bytes.Buffer
+	if err := export.WriteOpenMetrics(&b, testSamples()); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	got := b.String()
+
+	// Spot check the families which exercise each feature, rather than the
+	// full exposition.
+	for _, want := range []string{
+		"# TYPE taskstats_user_cpu_seconds counter\n" +
+			"# UNIT taskstats_user_cpu_seconds seconds\n" +
+			"# HELP taskstats_user_cpu_seconds CPU time spent running in user mode.\n" +
+			`taskstats_user_cpu_seconds_total{cgroup="/system.slice/my app.service",comm="a\"b",pid="10",tgid="10"} 1.5 1700000000.5` + "\n" +
+			`taskstats_user_cpu_seconds_total{comm="sh",pid="11"} 0` + "\n",
+		"# TYPE taskstats_cpu_delay_seconds counter\n" +
+			"# UNIT taskstats_cpu_delay_seconds seconds\n" +
+			"# HELP taskstats_cpu_delay_seconds Time spent waiting for a CPU while runnable.\n" +
+			`taskstats_cpu_delay_seconds_total{cgroup="/system.slice/my app.service",comm="a\"b",pid="10",tgid="10"} 0.25 1700000000.5` + "\n" +
+			"# TYPE taskstats_block_io_delays counter\n",
+		"# TYPE taskstats_peak_rss_bytes gauge\n" +
+			"# UNIT taskstats_peak_rss_bytes bytes\n" +
+			"# HELP taskstats_peak_rss_bytes Peak resident set size of the task's address space.\n" +
+			`taskstats_peak_rss_bytes{cgroup="/system.slice/my app.service",comm="a\"b",pid="10",tgid="10"} 4096 1700000000.5` + "\n" +
+			`taskstats_peak_rss_bytes{comm="sh",pid="11"} 0` + "\n",
+		"# TYPE taskstats_cgroup_tasks gauge\n" +
+			"# HELP taskstats_cgroup_tasks Number of tasks in the cgroup in each state.\n" +
+			`taskstats_cgroup_tasks{cgroup="/system.slice/my app.service",comm="a\"b",pid="10",tgid="10",state="sleeping"} 4 1700000000.5` + "\n",
+	} {
+		if !bytes.Contains(b.Bytes(), []byte(want)) {
+			t.Fatalf("exposition does not contain:\n%s\n\ngot:\n%s", want, got)
+		}
+	}
+
+	if !bytes.HasSuffix(b.Bytes(), []byte("# EOF\n")) {
+		t.Fatalf("exposition not terminated by EOF:\n%s", got)
+	}
+}
+
+func TestWriteOpenMetricsThreadGroups(t *testing.T) {
+	// Thread group statistics carry no identifiers, so each sample must be
+	// labeled using its TGID to produce distinct series.
+	samples := export.FromCollector([]taskstats.Sample{
+		{TGID: 1, Stats: &taskstats.Stats{UserCPUTime: time.Second}},
+		{TGID: 2, Stats: &taskstats.Stats{UserCPUTime: 2 * time.Second}},
+	})
+
+	var b bytes.Buffer
+	if err := export.WriteOpenMetrics(&b, samples); err != nil {
+		t.Fatalf("failed to write: %v", err)
+	}
+
+	want := `taskstats_user_cpu_seconds_total{tgid="1"} 1` + "\n" +
+		`taskstats_user_cpu_seconds_total{tgid="2"} 2` + "\n"
+	if !bytes.Contains(b.Bytes(), []byte(want)) {
+		t.Fatalf("exposition does not contain:\n%s\n\ngot:\n%s", want, b.String())
+	}
+}
+
+func TestCSVWriter(t *testing.T) {
+	var b bytes.Buffer
+	w := export.NewCSVWriter(&b)
+	w.Comma = '\t'
+
+	// Thread group statistics from a Collector carry no identifiers, so
+	// samples are identified by their TGIDs.
+	first := export.FromCollector([]taskstats.Sample{{
+		TGID: 10,
+		Time: time.Unix(1700000000, 0).UTC(),
+		Stats: &taskstats.Stats{
+			Comm:          "foo",
+			UserCPUTime:   1250 * time.Millisecond,
+			CPUDelayCount: 3,
+			PeakRSS:       4096,
+		},
+	}})
+
+	second := export.FromCollector([]taskstats.Sample{{
+		TGID: 10,
+		Time: time.Unix(1700000010, 0).UTC(),
+		Stats: &taskstats.Stats{
+			Comm:          "foo",
+			UserCPUTime:   1500 * time.Millisecond,
+			CPUDelayCount: 5,
+			PeakRSS:       8192,
+		},
+		Delta: &taskstats.Stats{
+			UserCPUTime:   250 * time.Millisecond,
+			CPUDelayCount: 2,
+		},
+	}})
+
+	second = append(second,
+		export.Sample{
+			PID: 11,
+			Stats: &taskstats.Stats{
+				PID:      11,
+				Comm:     "sh",
+				NoDelays: true,
+			},
+		},
+		// No Stats, skipped.
+		export.Sample{CGroupStats: &taskstats.CGroupStats{}},
+	)
+
+	for _, ss := range [][]export.Sample{first, second} {
+		if err := w.Write(ss); err != nil {
+			t.Fatalf("failed to write: %v", err)
+		}
+	}
+
+	want := "time\tcgroup\tpid\tppid\ttgid\tuid\tgid\tcomm\texit_code\tflags\tbegin_time\tno_delays\t" +
+		"elapsed_seconds\tuser_cpu_seconds\tsystem_cpu_seconds\tminor_page_faults\tmajor_page_faults\t" +
+		"cpu_delays\tcpu_delay_seconds\tblock_io_delays\tblock_io_delay_seconds\t" +
+		"swap_in_delays\tswap_in_delay_seconds\tfree_pages_delays\tfree_pages_delay_seconds\t" +
+		"thrashing_delays\tthrashing_delay_seconds\tread_bytes\twrite_bytes\tpeak_rss_bytes\tpeak_virtual_memory_bytes\t" +
+		"elapsed_seconds_delta\tuser_cpu_seconds_delta\tsystem_cpu_seconds_delta\tminor_page_faults_delta\tmajor_page_faults_delta\t" +
+		"cpu_delays_delta\tcpu_delay_seconds_delta\tblock_io_delays_delta\tblock_io_delay_seconds_delta\t" +
+		"swap_in_delays_delta\tswap_in_delay_seconds_delta\tfree_pages_delays_delta\tfree_pages_delay_seconds_delta\t" +
+		"thrashing_delays_delta\tthrashing_delay_seconds_delta\tread_bytes_delta\twrite_bytes_delta\n" +
+		"2023-11-14T22:13:20Z\t\t0\t0\t10\t0\t0\tfoo\t0\t0\t\tfalse\t" +
+		"0\t1.25\t0\t0\t0\t3\t0\t0\t0\t0\t0\t0\t0\t0\t0\t0\t0\t4096\t0\t" +
+		"\t\t\t\t\t\t\t\t\t\t\t\t\t\t\t\t\n" +
+		"2023-11-14T22:13:30Z\t\t0\t0\t10\t0\t0\tfoo\t0\t0\t\tfalse\t" +
+		"0\t1.5\t0\t0\t0\t5\t0\t0\t0\t0\t0\t0\t0\t0\t0\t0\t0\t8192\t0\t" +
+		"0\t0.25\t0\t0\t0\t2\t0\t0\t0\t0\t0\t0\t0\t0\t0\t0\t0\n" +
+		"\t\t11\t0\t0\t0\t0\tsh\t0\t0\t\ttrue\t" +
+		"0\t0\t0\t0\t0\t\t\t\t\t\t\t\t\t\t\t0\t0\t0\t0\t" +
+		"\t\t\t\t\t\t\t\t\t\t\t\t\t\t\t\t\n"
+
+	if diff := cmp.Diff(want, b.String()); diff != "" {
+		t.Fatalf("unexpected CSV (-want +got):\n%s", diff)
+	}
+}
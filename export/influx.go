@@ -0,0 +1,112 @@
+package export
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Measurement names used by WriteInflux.
+const (
+	influxStats       = "taskstats"
+	influxCGroupStats = "cgroupstats"
+)
+
+// WriteInflux writes samples to w in InfluxDB line protocol.
+//
+// Stats are written as the "taskstats" measurement and CGroupStats as the
+// "cgroupstats" measurement, tagged with the labels of each sample. Field
+// names match the snake case names of the statistics, durations are written
+// in floating point seconds, and counts and sizes are written as integers.
+// Integer fields are signed, so values exceeding math.MaxInt64 are clamped to
+// it rather than overflowing.
+// Delay statistics are omitted for Stats lacking delay accounting.
+// Timestamps are written with nanosecond precision.
+func WriteInflux(w io.Writer, samples []Sample) error {
+	var b bytes.Buffer
+	for _, s := range samples {
+		if st := s.Stats; st != nil {
+			writeInfluxKey(&b, influxStats, s)
+
+			first := true
+			for _, m := range statsMetrics {
+				if m.delay && st.NoDelays {
+					continue
+				}
+
+				writeInfluxField(&b, &first, m.name, m.value(st))
+			}
+
+			writeInfluxTime(&b, s)
+		}
+
+		if cs := s.CGroupStats; cs != nil {
+			writeInfluxKey(&b, influxCGroupStats, s)
+
+			first := true
+			for _, state := range cgroupStates {
+				writeInfluxField(&b, &first, state.name, integer(state.value(cs)))
+			}
+
+			writeInfluxTime(&b, s)
+		}
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// writeInfluxKey writes the measurement and tags of a line.
+func writeInfluxKey(b *bytes.Buffer, measurement string, s Sample) {
+	b.WriteString(measurement)
+	for _, l := range s.labels() {
+		b.WriteByte(',')
+		b.WriteString(influxEscape(l.name))
+		b.WriteByte('=')
+		b.WriteString(influxEscape(l.value))
+	}
+}
+
+// writeInfluxField writes a field of a line.
+func writeInfluxField(b *bytes.Buffer, first *bool, name string, v value) {
+	if *first {
+		b.WriteByte(' ')
+		*first = false
+	} else {
+		b.WriteByte(',')
+	}
+
+	b.WriteString(name)
+	b.WriteByte('=')
+	if v.isFloat {
+		b.WriteString(strconv.FormatFloat(v.f, 'f', -1, 64))
+	} else {
+		b.WriteString(strconv.FormatUint(min(v.i, math.MaxInt64), 10))
+		b.WriteByte('i')
+	}
+}
+
+// writeInfluxTime writes the timestamp of a line, if any, and ends the line.
+func writeInfluxTime(b *bytes.Buffer, s Sample) {
+	if !s.Time.IsZero() {
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatInt(s.Time.UnixNano(), 10))
+	}
+
+	b.WriteByte('\n')
+}
+
+// influxEscaper escapes tag keys and values.
+var influxEscaper = strings.NewReplacer(
+	`,`, `\,`,
+	`=`, `\=`,
+	` `, `\ `,
+	"\n", `\n`,
+)
+
+// influxEscape escapes a tag key or value.
+func influxEscape(s string) string {
+	return influxEscaper.Replace(s)
+}
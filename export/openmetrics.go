@@ -0,0 +1,141 @@
+package export
+
+import (
+	"bytes"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Metric family name prefixes used by WriteOpenMetrics.
+const (
+	openMetricsStats       = "taskstats_"
+	openMetricsCGroupTasks = "taskstats_cgroup_tasks"
+)
+
+// WriteOpenMetrics writes samples to w in the OpenMetrics text exposition
+// format, terminated by "# EOF".
+//
+// Each Stats field is written as a metric family named "taskstats_" followed
+// by the snake case name of the field, labeled with the labels of each
+// sample. CGroupStats are written as the "taskstats_cgroup_tasks" gauge,
+// with a "state" label for each task state. Delay statistics are omitted for
+// Stats lacking delay accounting. Timestamps are written in seconds.
+//
+// OpenMetrics requires that label sets within a metric family be unique, so
+// samples must not share the same labels.
+func WriteOpenMetrics(w io.Writer, samples []Sample) error {
+	var b bytes.Buffer
+
+	for _, m := range statsMetrics {
+		family := openMetricsStats + m.name
+
+		var wrote bool
+		for _, s := range samples {
+			st := s.Stats
+			if st == nil || (m.delay && st.NoDelays) {
+				continue
+			}
+
+			if !wrote {
+				writeOpenMetricsMeta(&b, family, m.kind, m.unit, m.help)
+				wrote = true
+			}
+
+			name := family
+			if m.kind == counter {
+				name += "_total"
+			}
+
+			writeOpenMetricsSample(&b, name, s.labels(), nil, m.value(st), s)
+		}
+	}
+
+	var wrote bool
+	for _, s := range samples {
+		cs := s.CGroupStats
+		if cs == nil {
+			continue
+		}
+
+		if !wrote {
+			writeOpenMetricsMeta(&b, openMetricsCGroupTasks, gauge, "", "Number of tasks in the cgroup in each state.")
+			wrote = true
+		}
+
+		for _, state := range cgroupStates {
+			writeOpenMetricsSample(&b, openMetricsCGroupTasks, s.labels(),
+				&label{"state", state.name}, integer(state.value(cs)), s)
+		}
+	}
+
+	b.WriteString("# EOF\n")
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// writeOpenMetricsMeta writes the metadata of a metric family.
+func writeOpenMetricsMeta(b *bytes.Buffer, family string, k kind, unit, help string) {
+	typ := "counter"
+	if k == gauge {
+		typ = "gauge"
+	}
+
+	b.WriteString("# TYPE " + family + " " + typ + "\n")
+	if unit != "" {
+		b.WriteString("# UNIT " + family + " " + unit + "\n")
+	}
+	b.WriteString("# HELP " + family + " " + openMetricsEscape(help) + "\n")
+}
+
+// writeOpenMetricsSample writes a sample of a metric family, with an optional
+// extra label following the labels of the sample.
+func writeOpenMetricsSample(b *bytes.Buffer, name string, ls []label, extra *label, v value, s Sample) {
+	if extra != nil {
+		ls = append(ls, *extra)
+	}
+
+	b.WriteString(name)
+	if len(ls) > 0 {
+		b.WriteByte('{')
+		for i, l := range ls {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+
+			b.WriteString(l.name + `="` + openMetricsEscape(l.value) + `"`)
+		}
+		b.WriteByte('}')
+	}
+
+	b.WriteByte(' ')
+	if v.isFloat {
+		b.WriteString(strconv.FormatFloat(v.f, 'g', -1, 64))
+	} else {
+		b.WriteString(strconv.FormatUint(v.i, 10))
+	}
+
+	if !s.Time.IsZero() {
+		// Format the timestamp in decimal to avoid losing precision.
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatInt(s.Time.Unix(), 10))
+		if ns := s.Time.Nanosecond(); ns > 0 {
+			b.WriteString(strings.TrimRight("."+strconv.Itoa(1e9 + ns)[1:], "0"))
+		}
+	}
+
+	b.WriteByte('\n')
+}
+
+// openMetricsEscaper escapes label values and help text.
+var openMetricsEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`"`, `\"`,
+	"\n", `\n`,
+)
+
+// openMetricsEscape escapes a label value or help text.
+func openMetricsEscape(s string) string {
+	return openMetricsEscaper.Replace(s)
+}
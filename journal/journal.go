@@ -0,0 +1,195 @@
+// Package journal persists taskstats exit events to a durable, append-only
+// journal on disk.
+//
+// A journal is a directory of segment files, each of which begins with a
+// header identifying the format, followed by a sequence of framed records.
+// Each frame holds the length and CRC-32C checksum of its record, so a frame
+// which was only partially written when a process or host crashed can be
+// detected and discarded. Records hold the time an exit was appended and the
+// exit in the binary encoding of taskstats.Exit.
+//
+// A Writer appends records to the newest segment, rotating to a new segment
+// as segments grow large or old, and removing the oldest segments to enforce
+// retention limits. A Reader reads records in the order they were appended,
+// and can follow a journal as records are appended to it.
+package journal
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mdlayher/taskstats"
+)
+
+const (
+	// segmentExt is the file extension of segment files.
+	segmentExt = ".seg"
+
+	// sizeofHeader is the size of a segment header, and sizeofFrameHeader is
+	// the size of the length and checksum which precede each record.
+	sizeofHeader      = 8
+	sizeofFrameHeader = 8
+
+	// maxRecordSize bounds the size of a record so that a corrupt length
+	// cannot cause an excessive allocation.
+	maxRecordSize = 1 << 16
+)
+
+// header identifies a segment file and the version of its format.
+var header = [sizeofHeader]byte{'t', 's', 'j', 'o', 'u', 'r', 0, 1}
+
+// crcTable is used to compute the checksum of each record.
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// ErrCorrupt is returned when a journal contains data which is neither a
+// valid record nor a partially written one.
+var ErrCorrupt = errors.New("journal: corrupt segment")
+
+// errIncomplete indicates that a segment ends partway through a header or
+// frame, either because it is still being written or because its writer
+// crashed.
+var errIncomplete = errors.New("journal: incomplete frame")
+
+// A Record is an exit event stored in a journal.
+type Record struct {
+	// Time is when the exit was appended to the journal.
+	Time time.Time
+
+	// Exit is the exit event.
+	Exit taskstats.Exit
+}
+
+// appendFrame appends the frame for r to b.
+func appendFrame(b []byte, r Record) ([]byte, error) {
+	exit, err := r.Exit.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	payload := binary.LittleEndian.AppendUint64(make([]byte, 0, 8+len(exit)), uint64(r.Time.UnixNano()))
+	payload = append(payload, exit...)
+
+	if len(payload) > maxRecordSize {
+		return nil, fmt.Errorf("journal: record of %d bytes exceeds maximum of %d bytes", len(payload), maxRecordSize)
+	}
+
+	b = binary.LittleEndian.AppendUint32(b, uint32(len(payload)))
+	b = binary.LittleEndian.AppendUint32(b, crc32.Checksum(payload, crcTable))
+	return append(b, payload...), nil
+}
+
+// readFrame reads the frame at offset off in f, returning its record and the
+// size of the frame.
+func readFrame(f io.ReaderAt, off int64) (Record, int64, error) {
+	var fh [sizeofFrameHeader]byte
+	if err := readFull(f, fh[:], off); err != nil {
+		return Record{}, 0, err
+	}
+
+	length := binary.LittleEndian.Uint32(fh[0:4])
+	if length < 8 || length > maxRecordSize {
+		return Record{}, 0, fmt.Errorf("%w: invalid record length %d at offset %d", ErrCorrupt, length, off)
+	}
+
+	payload := make([]byte, length)
+	if err := readFull(f, payload, off+sizeofFrameHeader); err != nil {
+		return Record{}, 0, err
+	}
+
+	if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(fh[4:8]) {
+		return Record{}, 0, fmt.Errorf("%w: checksum mismatch at offset %d", ErrCorrupt, off)
+	}
+
+	var e taskstats.Exit
+	if err := e.UnmarshalBinary(payload[8:]); err != nil {
+		return Record{}, 0, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+
+	r := Record{
+		Time: time.Unix(0, int64(binary.LittleEndian.Uint64(payload[0:8]))),
+		Exit: e,
+	}
+
+	return r, sizeofFrameHeader + int64(length), nil
+}
+
+// readHeader verifies the header of the segment f.
+func readHeader(f io.ReaderAt) error {
+	var b [sizeofHeader]byte
+	if err := readFull(f, b[:], 0); err != nil {
+		return err
+	}
+
+	if b != header {
+		return fmt.Errorf("%w: unrecognized segment header", ErrCorrupt)
+	}
+
+	return nil
+}
+
+// readFull reads len(b) bytes at offset off in f, returning errIncomplete if
+// f ends first.
+func readFull(f io.ReaderAt, b []byte, off int64) error {
+	n, err := f.ReadAt(b, off)
+	switch {
+	case n == len(b):
+		return nil
+	case err == nil || errors.Is(err, io.EOF):
+		return errIncomplete
+	default:
+		return err
+	}
+}
+
+// A segment is a segment file in a journal.
+type segment struct {
+	seq  uint64
+	path string
+}
+
+// segmentPath returns the path of the segment with sequence number seq.
+func segmentPath(dir string, seq uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%016x%s", seq, segmentExt))
+}
+
+// listSegments returns the segments in dir, ordered by sequence number.
+func listSegments(dir string) ([]segment, error) {
+	des, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var segs []segment
+	for _, de := range des {
+		name, ok := strings.CutSuffix(de.Name(), segmentExt)
+		if !ok || len(name) != 16 || de.IsDir() {
+			continue
+		}
+
+		seq, err := strconv.ParseUint(name, 16, 64)
+		if err != nil {
+			// Not a segment.
+			continue
+		}
+
+		segs = append(segs, segment{
+			seq:  seq,
+			path: filepath.Join(dir, de.Name()),
+		})
+	}
+
+	sort.Slice(segs, func(i, j int) bool {
+		return segs[i].seq < segs[j].seq
+	})
+
+	return segs, nil
+}
@@ -0,0 +1,528 @@
+package journal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/taskstats"
+)
+
+func TestJournalQuery(t *testing.T) {
+	dir := t.TempDir()
+
+	now := time.Unix(1000, 0)
+	w := testWriter(t, dir, &Options{SegmentAge: 10 * time.Second}, &now)
+
+	// One record per second, rotating every 10 seconds.
+	for i := 0; i < 25; i++ {
+		if err := w.Append(testExit(i)); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+
+		now = now.Add(time.Second)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	segs, err := listSegments(dir)
+	if err != nil {
+		t.Fatalf("failed to list segments: %v", err)
+	}
+	if diff := cmp.Diff(3, len(segs)); diff != "" {
+		t.Fatalf("unexpected number of segments (-want +got):\n%s", diff)
+	}
+
+	// Corrupt the newest record, which is never read as the query ends
+	// before it.
+	corruptLast(t, segs[2].path)
+
+	recs, err := Query(dir, time.Unix(1008, 0), time.Unix(1012, 0))
+	if err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+
+	var want []Record
+	for i := 8; i < 12; i++ {
+		want = append(want, Record{Time: time.Unix(int64(1000+i), 0), Exit: testExit(i)})
+	}
+
+	if diff := cmp.Diff(want, recs); diff != "" {
+		t.Fatalf("unexpected records (-want +got):\n%s", diff)
+	}
+}
+
+func TestJournalRetention(t *testing.T) {
+	dir := t.TempDir()
+
+	now := time.Unix(1000, 0)
+	w := testWriter(t, dir, &Options{SegmentSize: 64, MaxSize: 256}, &now)
+	defer w.Close()
+
+	for i := 0; i < 50; i++ {
+		if err := w.Append(testExit(i)); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+
+	segs, err := listSegments(dir)
+	if err != nil {
+		t.Fatalf("failed to list segments: %v", err)
+	}
+
+	var total int64
+	for _, s := range segs {
+		fi, err := os.Stat(s.path)
+		if err != nil {
+			t.Fatalf("failed to stat segment: %v", err)
+		}
+		total += fi.Size()
+	}
+
+	if total > 256 {
+		t.Fatalf("journal size %d exceeds maximum", total)
+	}
+
+	// Only the newest records remain.
+	recs, err := Query(dir, time.Time{}, now.Add(time.Second))
+	if err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+
+	if len(recs) == 0 || recs[len(recs)-1].Exit.PID != 49 {
+		t.Fatalf("unexpected records after retention: %v", recs)
+	}
+}
+
+func TestJournalMaxAge(t *testing.T) {
+	dir := t.TempDir()
+
+	now := time.Now()
+	w := testWriter(t, dir, &Options{SegmentSize: 64, MaxAge: time.Hour}, &now)
+	defer w.Close()
+
+	if err := w.Append(testExit(1)); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+
+	segs, err := listSegments(dir)
+	if err != nil {
+		t.Fatalf("failed to list segments: %v", err)
+	}
+
+	// Age the first segment, which is removed by the next rotation.
+	old := now.Add(-2 * time.Hour)
+	if err := os.Chtimes(segs[0].path, old, old); err != nil {
+		t.Fatalf("failed to age segment: %v", err)
+	}
+
+	if err := w.Append(testExit(2)); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+
+	if _, err := os.Stat(segs[0].path); !os.IsNotExist(err) {
+		t.Fatalf("expected aged segment to be removed, but got: %v", err)
+	}
+}
+
+func TestJournalCrash(t *testing.T) {
+	dir := t.TempDir()
+
+	now := time.Unix(1000, 0)
+	w := testWriter(t, dir, nil, &now)
+	for i := 0; i < 3; i++ {
+		if err := w.Append(testExit(i)); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	// Simulate a crash partway through writing a frame.
+	segs, err := listSegments(dir)
+	if err != nil {
+		t.Fatalf("failed to list segments: %v", err)
+	}
+
+	before, err := os.Stat(segs[0].path)
+	if err != nil {
+		t.Fatalf("failed to stat segment: %v", err)
+	}
+
+	f, err := os.OpenFile(segs[0].path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("failed to open segment: %v", err)
+	}
+	if _, err := f.Write([]byte{0x20, 0x00, 0x00, 0x00, 0xff}); err != nil {
+		t.Fatalf("failed to write partial frame: %v", err)
+	}
+	_ = f.Close()
+
+	r := NewReader(dir, time.Time{})
+	defer r.Close()
+
+	for i := 0; i < 3; i++ {
+		if _, err := r.Next(); err != nil {
+			t.Fatalf("failed to read record %d: %v", i, err)
+		}
+	}
+
+	// The partial frame may still be written, so nothing more is available.
+	if _, err := r.Next(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected EOF, but got: %v", err)
+	}
+
+	// Reopening repairs the segment and appends to a new one, which the
+	// reader continues with.
+	w = testWriter(t, dir, nil, &now)
+	defer w.Close()
+
+	if err := w.Append(testExit(3)); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+
+	rec, err := r.Next()
+	if err != nil {
+		t.Fatalf("failed to read record after recovery: %v", err)
+	}
+
+	if diff := cmp.Diff(testExit(3), rec.Exit); diff != "" {
+		t.Fatalf("unexpected exit (-want +got):\n%s", diff)
+	}
+
+	after, err := os.Stat(segs[0].path)
+	if err != nil {
+		t.Fatalf("failed to stat segment: %v", err)
+	}
+
+	if diff := cmp.Diff(before.Size(), after.Size()); diff != "" {
+		t.Fatalf("partial frame was not truncated (-want +got):\n%s", diff)
+	}
+}
+
+func TestJournalCorrupt(t *testing.T) {
+	dir := t.TempDir()
+
+	now := time.Unix(1000, 0)
+	w := testWriter(t, dir, &Options{SegmentAge: 10 * time.Second}, &now)
+	for i := 0; i < 3; i++ {
+		if err := w.Append(testExit(i)); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+
+		// Rotate before the final record.
+		now = now.Add(5 * time.Second)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	corruptLast(t, segmentPath(dir, 0))
+
+	r := NewReader(dir, time.Time{})
+	defer r.Close()
+
+	if _, err := r.Next(); err != nil {
+		t.Fatalf("failed to read record: %v", err)
+	}
+
+	if _, err := r.Next(); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected corrupt segment, but got: %v", err)
+	}
+
+	// The remainder of the corrupt segment is skipped.
+	rec, err := r.Next()
+	if err != nil {
+		t.Fatalf("failed to read record after corruption: %v", err)
+	}
+
+	if diff := cmp.Diff(testExit(2), rec.Exit); diff != "" {
+		t.Fatalf("unexpected exit (-want +got):\n%s", diff)
+	}
+
+	if _, err := r.Next(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected EOF, but got: %v", err)
+	}
+}
+
+func TestJournalRepairCorrupt(t *testing.T) {
+	dir := t.TempDir()
+
+	now := time.Unix(1000, 0)
+	w := testWriter(t, dir, nil, &now)
+	for i := 0; i < 2; i++ {
+		if err := w.Append(testExit(i)); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+
+	path := segmentPath(dir, 0)
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat segment: %v", err)
+	}
+
+	if err := w.Append(testExit(2)); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	// Simulate a crash which left the final frame complete but corrupt.
+	corruptLast(t, path)
+
+	w = testWriter(t, dir, nil, &now)
+	defer w.Close()
+
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat segment: %v", err)
+	}
+
+	if diff := cmp.Diff(before.Size(), after.Size()); diff != "" {
+		t.Fatalf("corrupt frame was not truncated (-want +got):\n%s", diff)
+	}
+
+	recs, err := Query(dir, time.Time{}, now.Add(time.Second))
+	if err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+
+	if diff := cmp.Diff(2, len(recs)); diff != "" {
+		t.Fatalf("unexpected number of records (-want +got):\n%s", diff)
+	}
+}
+
+func TestJournalRepairKeepsCorruptMiddle(t *testing.T) {
+	dir := t.TempDir()
+
+	now := time.Unix(1000, 0)
+	w := testWriter(t, dir, nil, &now)
+	for i := 0; i < 3; i++ {
+		if err := w.Append(testExit(i)); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	// Corruption followed by intact records was not caused by a crash, so
+	// the records are kept.
+	path := segmentPath(dir, 0)
+	corruptFirst(t, path)
+
+	before, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat segment: %v", err)
+	}
+
+	w = testWriter(t, dir, nil, &now)
+	defer w.Close()
+
+	after, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("failed to stat segment: %v", err)
+	}
+
+	if diff := cmp.Diff(before.Size(), after.Size()); diff != "" {
+		t.Fatalf("segment was truncated (-want +got):\n%s", diff)
+	}
+}
+
+func TestReaderFromCorruptFirstRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	now := time.Unix(1000, 0)
+	w := testWriter(t, dir, &Options{SegmentAge: 10 * time.Second}, &now)
+	for i := 0; i < 4; i++ {
+		if err := w.Append(testExit(i)); err != nil {
+			t.Fatalf("failed to append: %v", err)
+		}
+
+		now = now.Add(5 * time.Second)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	// The start time of the newest segment is unknown, so the reader starts
+	// with the older segment, skipping its records, and reports the
+	// corruption once.
+	corruptFirst(t, segmentPath(dir, 1))
+
+	r := NewReader(dir, time.Unix(1012, 0))
+	defer r.Close()
+
+	if _, err := r.Next(); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected corrupt segment, but got: %v", err)
+	}
+
+	if _, err := r.Next(); !errors.Is(err, io.EOF) {
+		t.Fatalf("expected EOF, but got: %v", err)
+	}
+}
+
+func TestWriterRotateError(t *testing.T) {
+	dir := t.TempDir()
+
+	now := time.Unix(1000, 0)
+	w := testWriter(t, dir, &Options{SegmentAge: 10 * time.Second}, &now)
+	defer w.Close()
+
+	if err := w.Append(testExit(0)); err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+
+	// Occupy the path of the next segment so it cannot be created.
+	next := segmentPath(dir, 1)
+	if err := os.Mkdir(next, 0o755); err != nil {
+		t.Fatalf("failed to create directory: %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	for i := 0; i < 2; i++ {
+		if err := w.Append(testExit(1)); !errors.Is(err, os.ErrExist) {
+			t.Fatalf("expected segment creation error, but got: %v", err)
+		}
+	}
+
+	// Once the cause is resolved, appending resumes.
+	if err := os.Remove(next); err != nil {
+		t.Fatalf("failed to remove directory: %v", err)
+	}
+	if err := w.Append(testExit(1)); err != nil {
+		t.Fatalf("failed to append after recovery: %v", err)
+	}
+
+	recs, err := Query(dir, time.Time{}, now.Add(time.Second))
+	if err != nil {
+		t.Fatalf("failed to query: %v", err)
+	}
+
+	if diff := cmp.Diff(2, len(recs)); diff != "" {
+		t.Fatalf("unexpected number of records (-want +got):\n%s", diff)
+	}
+}
+
+func TestReaderTail(t *testing.T) {
+	dir := t.TempDir()
+
+	now := time.Unix(1000, 0)
+	w := testWriter(t, dir, nil, &now)
+	defer w.Close()
+
+	r := NewReader(dir, time.Time{})
+	defer r.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	errC := make(chan error, 1)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		errC <- w.Append(testExit(7))
+	}()
+
+	rec, err := r.Tail(ctx, time.Millisecond)
+	if err != nil {
+		t.Fatalf("failed to tail: %v", err)
+	}
+	if err := <-errC; err != nil {
+		t.Fatalf("failed to append: %v", err)
+	}
+
+	if diff := cmp.Diff(testExit(7), rec.Exit); diff != "" {
+		t.Fatalf("unexpected exit (-want +got):\n%s", diff)
+	}
+}
+
+func TestListSegments(t *testing.T) {
+	dir := t.TempDir()
+
+	for _, name := range []string{
+		"000000000000000a.seg",
+		"0000000000000002.seg",
+		"notes.txt",
+		"bad.seg",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatalf("failed to create file: %v", err)
+		}
+	}
+
+	segs, err := listSegments(dir)
+	if err != nil {
+		t.Fatalf("failed to list segments: %v", err)
+	}
+
+	var seqs []uint64
+	for _, s := range segs {
+		seqs = append(seqs, s.seq)
+	}
+
+	if diff := cmp.Diff([]uint64{2, 10}, seqs); diff != "" {
+		t.Fatalf("unexpected segments (-want +got):\n%s", diff)
+	}
+}
+
+func testWriter(t *testing.T, dir string, opts *Options, now *time.Time) *Writer {
+	t.Helper()
+
+	w, err := open(dir, opts, func() time.Time { return *now })
+	if err != nil {
+		t.Fatalf("failed to open journal: %v", err)
+	}
+
+	return w
+}
+
+// corruptLast flips a bit in the last record of the segment at path.
+func corruptLast(t *testing.T, path string) {
+	t.Helper()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read segment: %v", err)
+	}
+
+	b[len(b)-1] ^= 0x01
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatalf("failed to write segment: %v", err)
+	}
+}
+
+// corruptFirst flips a bit in the first record of the segment at path.
+func corruptFirst(t *testing.T, path string) {
+	t.Helper()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read segment: %v", err)
+	}
+
+	b[sizeofHeader+sizeofFrameHeader] ^= 0x01
+	if err := os.WriteFile(path, b, 0o644); err != nil {
+		t.Fatalf("failed to write segment: %v", err)
+	}
+}
+
+func testExit(pid int) taskstats.Exit {
+	return taskstats.Exit{
+		PID: pid,
+		Stats: &taskstats.Stats{
+			PID:         pid,
+			Comm:        "true",
+			UserCPUTime: time.Duration(pid) * time.Millisecond,
+		},
+	}
+}
@@ -0,0 +1,240 @@
+package journal
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"time"
+)
+
+// A Reader reads the records of a journal in the order they were appended.
+// A Reader may be used while a Writer appends to the same journal.
+type Reader struct {
+	dir  string
+	from time.Time
+
+	f    *os.File
+	seq  uint64
+	off  int64
+	init bool
+}
+
+// NewReader creates a Reader for the journal in the directory dir which
+// reads records appended at or after from. Use the zero time.Time to read
+// every record.
+func NewReader(dir string, from time.Time) *Reader {
+	return &Reader{
+		dir:  dir,
+		from: from,
+	}
+}
+
+// Next returns the next record. If no more records are available, Next
+// returns io.EOF, and may be called again later to read records which have
+// since been appended.
+//
+// Segments which are removed by a Writer's retention limits before they are
+// read are skipped. If a segment is corrupt, Next returns an error wrapping
+// ErrCorrupt, and the next call skips the remainder of that segment, as the
+// boundaries of any frames following the corruption cannot be trusted.
+func (r *Reader) Next() (Record, error) {
+	for {
+		if r.f == nil {
+			ok, err := r.open()
+			if err != nil {
+				return Record{}, err
+			}
+			if !ok {
+				return Record{}, io.EOF
+			}
+		}
+
+		rec, n, err := readFrame(r.f, r.off)
+		switch {
+		case err == nil:
+			r.off += n
+			if rec.Time.Before(r.from) {
+				continue
+			}
+
+			return rec, nil
+		case errors.Is(err, errIncomplete):
+			// The end of this segment has been reached. If a newer segment
+			// exists, this one will never be appended to again, and any
+			// partial frame at its end was left by a crash.
+			newer, err := r.newer()
+			if err != nil {
+				return Record{}, err
+			}
+			if !newer {
+				return Record{}, io.EOF
+			}
+
+			_ = r.f.Close()
+			r.f = nil
+			r.seq++
+		case errors.Is(err, ErrCorrupt):
+			_ = r.f.Close()
+			r.f = nil
+			r.seq++
+			return Record{}, err
+		default:
+			return Record{}, err
+		}
+	}
+}
+
+// Tail is like Next, but when no more records are available, it polls the
+// journal every interval until a record is appended or ctx is canceled.
+func (r *Reader) Tail(ctx context.Context, interval time.Duration) (Record, error) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		rec, err := r.Next()
+		if !errors.Is(err, io.EOF) {
+			return rec, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return Record{}, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// Close releases resources used by a Reader.
+func (r *Reader) Close() error {
+	if r.f == nil {
+		return nil
+	}
+
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
+
+// open opens the oldest segment with a sequence number of at least r.seq,
+// reporting whether one was found. On the first call, segments which only
+// contain records older than r.from are skipped.
+func (r *Reader) open() (bool, error) {
+	segs, err := listSegments(r.dir)
+	if err != nil {
+		return false, err
+	}
+
+	if !r.init && !r.from.IsZero() {
+		// Start at the newest segment whose first record is no newer than
+		// from, as every older segment only contains older records. A
+		// segment whose first record cannot be read has an unknown start
+		// time, so older segments are considered instead, and any error is
+		// reported when the segment is read.
+		for i := len(segs) - 1; i > 0; i-- {
+			if t, ok := firstTime(segs[i].path); ok && !t.After(r.from) {
+				segs = segs[i:]
+				break
+			}
+		}
+	}
+	r.init = true
+
+	for i, s := range segs {
+		if s.seq < r.seq {
+			continue
+		}
+
+		f, err := os.Open(s.path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				// Removed by retention.
+				continue
+			}
+
+			return false, err
+		}
+
+		if err := readHeader(f); err != nil {
+			_ = f.Close()
+			if errors.Is(err, ErrCorrupt) {
+				// Skip this segment on the next call.
+				r.seq = s.seq + 1
+			}
+			if !errors.Is(err, errIncomplete) {
+				return false, err
+			}
+
+			if i == len(segs)-1 {
+				// The header is still being written.
+				return false, nil
+			}
+
+			// The writer crashed while writing the header.
+			continue
+		}
+
+		r.f, r.seq, r.off = f, s.seq, sizeofHeader
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// newer reports whether a segment newer than the current segment exists.
+func (r *Reader) newer() (bool, error) {
+	segs, err := listSegments(r.dir)
+	if err != nil {
+		return false, err
+	}
+
+	return len(segs) > 0 && segs[len(segs)-1].seq > r.seq, nil
+}
+
+// firstTime returns the time of the first record in the segment at path. ok
+// is false if the segment has no first record or it cannot be read.
+func firstTime(path string) (t time.Time, ok bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer f.Close()
+
+	if err := readHeader(f); err != nil {
+		return time.Time{}, false
+	}
+
+	rec, _, err := readFrame(f, sizeofHeader)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return rec.Time, true
+}
+
+// Query returns the records of the journal in the directory dir which were
+// appended at or after from and before to. Records are appended in time
+// order, so the journal is only read until the first record appended at or
+// after to.
+func Query(dir string, from, to time.Time) ([]Record, error) {
+	r := NewReader(dir, from)
+	defer r.Close()
+
+	var recs []Record
+	for {
+		rec, err := r.Next()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return recs, nil
+			}
+
+			return nil, err
+		}
+
+		if !rec.Time.Before(to) {
+			return recs, nil
+		}
+
+		recs = append(recs, rec)
+	}
+}
@@ -0,0 +1,424 @@
+package journal
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/taskstats"
+)
+
+// Default values for Options fields.
+const (
+	DefaultSegmentSize = 64 << 20
+	DefaultSegmentAge  = time.Hour
+)
+
+// Options configures a Writer. The zero value is valid.
+type Options struct {
+	// SegmentSize is the size in bytes at which a segment is rotated. If
+	// zero, DefaultSegmentSize is used.
+	SegmentSize int64
+
+	// SegmentAge is the age at which a segment is rotated. If zero,
+	// DefaultSegmentAge is used.
+	SegmentAge time.Duration
+
+	// MaxSize, if non-zero, limits the total size in bytes of the journal.
+	// When a segment is rotated, the oldest segments are removed until the
+	// journal would fit within MaxSize once the new segment is full.
+	MaxSize int64
+
+	// MaxAge, if non-zero, limits the age of the records in the journal.
+	// When a segment is rotated, segments whose newest record is older than
+	// MaxAge are removed.
+	MaxAge time.Duration
+
+	// Sync, if true, flushes each record to stable storage before Append
+	// returns. Otherwise, records are flushed when segments are rotated and
+	// when the Writer is closed, and records appended shortly before a host
+	// crash may be lost.
+	Sync bool
+}
+
+// A Writer appends exit events to a journal. A Writer is safe for concurrent
+// use, but only one Writer may use a journal directory at a time.
+type Writer struct {
+	dir  string
+	opts Options
+	now  func() time.Time
+
+	mu      sync.Mutex
+	f       *os.File
+	closed  bool
+	seq     uint64
+	size    int64
+	created time.Time
+	buf     []byte
+}
+
+// Open opens the journal in the directory dir for writing, creating the
+// directory if necessary. If opts is nil, a default configuration is used.
+//
+// If the newest segment of an existing journal ends with a frame which was
+// only partially written because its writer crashed, the frame is discarded.
+// Corruption elsewhere in the segment is left for Readers to report. Records
+// are then appended to a new segment.
+func Open(dir string, opts *Options) (*Writer, error) {
+	return open(dir, opts, time.Now)
+}
+
+// open opens a Writer which reads the current time using now.
+func open(dir string, opts *Options, now func() time.Time) (*Writer, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+
+	o := *opts
+	if o.SegmentSize == 0 {
+		o.SegmentSize = DefaultSegmentSize
+	}
+	if o.SegmentAge == 0 {
+		o.SegmentAge = DefaultSegmentAge
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	segs, err := listSegments(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Writer{
+		dir:  dir,
+		opts: o,
+		now:  now,
+	}
+
+	if len(segs) > 0 {
+		last := segs[len(segs)-1]
+		if err := repair(last.path); err != nil {
+			return nil, err
+		}
+
+		w.seq = last.seq + 1
+	}
+
+	if err := w.create(); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// Append appends the exit event e to the journal, recording the current time.
+func (w *Writer) Append(e taskstats.Exit) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return os.ErrClosed
+	}
+	if w.f == nil {
+		// Creating the segment failed during rotation, so try again.
+		if err := w.create(); err != nil {
+			return err
+		}
+	}
+
+	now := w.now()
+
+	b, err := appendFrame(w.buf[:0], Record{Time: now, Exit: e})
+	if err != nil {
+		return err
+	}
+	w.buf = b
+
+	// Never rotate an empty segment, so that a record larger than the
+	// segment size is still written.
+	if w.size > sizeofHeader && (w.size+int64(len(b)) > w.opts.SegmentSize || now.Sub(w.created) >= w.opts.SegmentAge) {
+		if err := w.rotate(now); err != nil {
+			return err
+		}
+	}
+
+	// A single write per frame, so a crash leaves at most one partial frame.
+	n, err := w.f.Write(b)
+	w.size += int64(n)
+	if err != nil {
+		return err
+	}
+
+	if w.opts.Sync {
+		return w.f.Sync()
+	}
+
+	return nil
+}
+
+// Close flushes and closes the journal.
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+
+	if w.f == nil {
+		return nil
+	}
+
+	err := w.closeSegment()
+	w.f = nil
+	return err
+}
+
+// create creates the segment with the Writer's sequence number and writes its
+// header.
+func (w *Writer) create() error {
+	path := segmentPath(w.dir, w.seq)
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(header[:]); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return err
+	}
+
+	// Ensure the new segment survives a crash.
+	if err := f.Sync(); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return err
+	}
+	if err := syncDir(w.dir); err != nil {
+		_ = f.Close()
+		_ = os.Remove(path)
+		return err
+	}
+
+	w.f = f
+	w.size = sizeofHeader
+	w.created = w.now()
+	return nil
+}
+
+// rotate closes the current segment, creates a new one, and enforces
+// retention limits. If the new segment cannot be created, the next call to
+// Append tries again.
+func (w *Writer) rotate(now time.Time) error {
+	err := w.closeSegment()
+	w.f = nil
+	if err != nil {
+		// The segment was closed regardless, so move on to a new one.
+		w.seq++
+		return err
+	}
+
+	w.seq++
+	if err := w.create(); err != nil {
+		return err
+	}
+
+	return w.retain(now)
+}
+
+// closeSegment flushes and closes the current segment.
+func (w *Writer) closeSegment() error {
+	if err := w.f.Sync(); err != nil {
+		_ = w.f.Close()
+		return err
+	}
+
+	return w.f.Close()
+}
+
+// retain removes the oldest inactive segments which exceed the retention
+// limits. The active segment is never removed.
+func (w *Writer) retain(now time.Time) error {
+	if w.opts.MaxSize == 0 && w.opts.MaxAge == 0 {
+		return nil
+	}
+
+	segs, err := listSegments(w.dir)
+	if err != nil {
+		return err
+	}
+
+	type info struct {
+		segment
+		size     int64
+		modified time.Time
+	}
+
+	var (
+		infos []info
+		// Reserve room for the active segment to fill.
+		total = w.opts.SegmentSize
+	)
+
+	for _, s := range segs {
+		if s.seq >= w.seq {
+			break
+		}
+
+		fi, err := os.Stat(s.path)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+
+			return err
+		}
+
+		infos = append(infos, info{segment: s, size: fi.Size(), modified: fi.ModTime()})
+		total += fi.Size()
+	}
+
+	for _, in := range infos {
+		// A segment's modification time is the time its newest record was
+		// appended.
+		tooLarge := w.opts.MaxSize > 0 && total > w.opts.MaxSize
+		tooOld := w.opts.MaxAge > 0 && now.Sub(in.modified) > w.opts.MaxAge
+		if !tooLarge && !tooOld {
+			break
+		}
+
+		if err := os.Remove(in.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		total -= in.size
+	}
+
+	return nil
+}
+
+// repair truncates the segment at path after its last intact record if it
+// ends with a torn frame, which was only partially written or whose blocks
+// were not all written before a host crashed. A corrupt frame which is
+// followed by other data is left in place, as records may follow it. A
+// segment without a complete header is removed.
+func repair(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := readHeader(f); err != nil {
+		if !errors.Is(err, errIncomplete) {
+			return err
+		}
+
+		// Crashed while writing the header, so no records were written.
+		return os.Remove(path)
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	off := int64(sizeofHeader)
+	for {
+		_, n, err := readFrame(f, off)
+		if err == nil {
+			off += n
+			continue
+		}
+
+		if errors.Is(err, ErrCorrupt) {
+			torn, err := tornFrame(f, off, fi.Size())
+			if err != nil {
+				return err
+			}
+			if !torn {
+				return nil
+			}
+
+			break
+		}
+		if !errors.Is(err, errIncomplete) {
+			return err
+		}
+
+		break
+	}
+
+	if fi.Size() == off {
+		return nil
+	}
+
+	if err := f.Truncate(off); err != nil {
+		return err
+	}
+
+	return f.Sync()
+}
+
+// tornFrame reports whether the corrupt frame at offset off in f, a file of
+// size bytes, was torn by a crash. The frame must be the last in the file,
+// and anything following it, such as blocks which were allocated but never
+// written, must read as zeros.
+func tornFrame(f io.ReaderAt, off, size int64) (bool, error) {
+	var fh [sizeofFrameHeader]byte
+	if err := readFull(f, fh[:], off); err != nil {
+		return false, err
+	}
+
+	// If the length itself is corrupt, the frame cannot be skipped.
+	if length := int64(binary.LittleEndian.Uint32(fh[0:4])); length >= 8 && length <= maxRecordSize {
+		off += sizeofFrameHeader + length
+	}
+
+	b := make([]byte, 32<<10)
+	for off < size {
+		n, err := f.ReadAt(b[:min(int64(len(b)), size-off)], off)
+		if !allZero(b[:n]) {
+			return false, nil
+		}
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			return false, err
+		}
+
+		off += int64(n)
+	}
+
+	return true, nil
+}
+
+// allZero reports whether b contains only zero bytes.
+func allZero(b []byte) bool {
+	for _, c := range b {
+		if c != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// syncDir flushes the directory entries of dir to stable storage.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
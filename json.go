@@ -0,0 +1,219 @@
+package taskstats
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// jsonVersion is the version of the JSON encoding of Stats and CGroupStats.
+const jsonVersion = 1
+
+var (
+	_ json.Marshaler   = Stats{}
+	_ json.Unmarshaler = &Stats{}
+	_ json.Marshaler   = CGroupStats{}
+	_ json.Unmarshaler = &CGroupStats{}
+)
+
+// statsJSON is the JSON encoding of Stats.
+type statsJSON struct {
+	Version             int    `json:"version"`
+	PID                 int    `json:"pid"`
+	PPID                int    `json:"ppid"`
+	TGID                int    `json:"tgid"`
+	UID                 uint32 `json:"uid"`
+	GID                 uint32 `json:"gid"`
+	Comm                string `json:"comm"`
+	ExitCode            uint32 `json:"exit_code"`
+	Flags               uint8  `json:"flags"`
+	BeginTime           string `json:"begin_time,omitempty"`
+	ElapsedTime         int64  `json:"elapsed_ns"`
+	GroupElapsedTime    int64  `json:"group_elapsed_ns"`
+	UserCPUTime         int64  `json:"user_cpu_ns"`
+	SystemCPUTime       int64  `json:"system_cpu_ns"`
+	MinorPageFaults     uint64 `json:"minor_page_faults"`
+	MajorPageFaults     uint64 `json:"major_page_faults"`
+	CPUDelayCount       uint64 `json:"cpu_delay_count"`
+	CPUDelay            int64  `json:"cpu_delay_ns"`
+	BlockIODelayCount   uint64 `json:"block_io_delay_count"`
+	BlockIODelay        int64  `json:"block_io_delay_ns"`
+	SwapInDelayCount    uint64 `json:"swap_in_delay_count"`
+	SwapInDelay         int64  `json:"swap_in_delay_ns"`
+	FreePagesDelayCount uint64 `json:"free_pages_delay_count"`
+	FreePagesDelay      int64  `json:"free_pages_delay_ns"`
+	ThrashingDelayCount uint64 `json:"thrashing_delay_count"`
+	ThrashingDelay      int64  `json:"thrashing_delay_ns"`
+	PeakRSS             uint64 `json:"peak_rss_bytes"`
+	PeakVirtualMemory   uint64 `json:"peak_virtual_memory_bytes"`
+	ReadBytes           uint64 `json:"read_bytes"`
+	WriteBytes          uint64 `json:"write_bytes"`
+	NoDelays            bool   `json:"no_delays,omitempty"`
+}
+
+// MarshalJSON implements json.Marshaler.
+//
+// Stats is encoded as a JSON object with a "version" field, currently 1, and
+// one field per Stats field in snake case. Durations are encoded as integer
+// nanoseconds, with names ending in "_ns", and memory sizes are encoded as
+// integer bytes, with names ending in "_bytes". BeginTime is encoded as an RFC 3339
+// timestamp with nanosecond precision in the "begin_time" field, which is
+// omitted if BeginTime is the zero time. The "no_delays" field is omitted
+// unless NoDelays is true.
+func (s Stats) MarshalJSON() ([]byte, error) {
+	var begin string
+	if !s.BeginTime.IsZero() {
+		begin = s.BeginTime.Format(time.RFC3339Nano)
+	}
+
+	return json.Marshal(statsJSON{
+		Version:             jsonVersion,
+		PID:                 s.PID,
+		PPID:                s.PPID,
+		TGID:                s.TGID,
+		UID:                 s.UID,
+		GID:                 s.GID,
+		Comm:                s.Comm,
+		ExitCode:            s.ExitCode,
+		Flags:               uint8(s.Flags),
+		BeginTime:           begin,
+		ElapsedTime:         int64(s.ElapsedTime),
+		GroupElapsedTime:    int64(s.GroupElapsedTime),
+		UserCPUTime:         int64(s.UserCPUTime),
+		SystemCPUTime:       int64(s.SystemCPUTime),
+		MinorPageFaults:     s.MinorPageFaults,
+		MajorPageFaults:     s.MajorPageFaults,
+		CPUDelayCount:       s.CPUDelayCount,
+		CPUDelay:            int64(s.CPUDelay),
+		BlockIODelayCount:   s.BlockIODelayCount,
+		BlockIODelay:        int64(s.BlockIODelay),
+		SwapInDelayCount:    s.SwapInDelayCount,
+		SwapInDelay:         int64(s.SwapInDelay),
+		FreePagesDelayCount: s.FreePagesDelayCount,
+		FreePagesDelay:      int64(s.FreePagesDelay),
+		ThrashingDelayCount: s.ThrashingDelayCount,
+		ThrashingDelay:      int64(s.ThrashingDelay),
+		PeakRSS:             s.PeakRSS,
+		PeakVirtualMemory:   s.PeakVirtualMemory,
+		ReadBytes:           s.ReadBytes,
+		WriteBytes:          s.WriteBytes,
+		NoDelays:            s.NoDelays,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler, decoding the encoding produced
+// by MarshalJSON. Unknown fields are ignored, and an error is returned if the
+// version is missing or unsupported.
+func (s *Stats) UnmarshalJSON(b []byte) error {
+	var sj statsJSON
+	if err := json.Unmarshal(b, &sj); err != nil {
+		return err
+	}
+
+	if err := checkJSONVersion("Stats", sj.Version); err != nil {
+		return err
+	}
+
+	var begin time.Time
+	if sj.BeginTime != "" {
+		t, err := time.Parse(time.RFC3339Nano, sj.BeginTime)
+		if err != nil {
+			return fmt.Errorf("taskstats: invalid Stats JSON begin time: %w", err)
+		}
+		begin = t
+	}
+
+	*s = Stats{
+		PID:                 sj.PID,
+		PPID:                sj.PPID,
+		TGID:                sj.TGID,
+		UID:                 sj.UID,
+		GID:                 sj.GID,
+		Comm:                sj.Comm,
+		ExitCode:            sj.ExitCode,
+		Flags:               AccountingFlags(sj.Flags),
+		BeginTime:           begin,
+		ElapsedTime:         time.Duration(sj.ElapsedTime),
+		GroupElapsedTime:    time.Duration(sj.GroupElapsedTime),
+		UserCPUTime:         time.Duration(sj.UserCPUTime),
+		SystemCPUTime:       time.Duration(sj.SystemCPUTime),
+		MinorPageFaults:     sj.MinorPageFaults,
+		MajorPageFaults:     sj.MajorPageFaults,
+		CPUDelayCount:       sj.CPUDelayCount,
+		CPUDelay:            time.Duration(sj.CPUDelay),
+		BlockIODelayCount:   sj.BlockIODelayCount,
+		BlockIODelay:        time.Duration(sj.BlockIODelay),
+		SwapInDelayCount:    sj.SwapInDelayCount,
+		SwapInDelay:         time.Duration(sj.SwapInDelay),
+		FreePagesDelayCount: sj.FreePagesDelayCount,
+		FreePagesDelay:      time.Duration(sj.FreePagesDelay),
+		ThrashingDelayCount: sj.ThrashingDelayCount,
+		ThrashingDelay:      time.Duration(sj.ThrashingDelay),
+		PeakRSS:             sj.PeakRSS,
+		PeakVirtualMemory:   sj.PeakVirtualMemory,
+		ReadBytes:           sj.ReadBytes,
+		WriteBytes:          sj.WriteBytes,
+		NoDelays:            sj.NoDelays,
+	}
+
+	return nil
+}
+
+// cgroupStatsJSON is the JSON encoding of CGroupStats.
+type cgroupStatsJSON struct {
+	Version         int    `json:"version"`
+	Sleeping        uint64 `json:"sleeping"`
+	Running         uint64 `json:"running"`
+	Stopped         uint64 `json:"stopped"`
+	Uninterruptible uint64 `json:"uninterruptible"`
+	IOWait          uint64 `json:"io_wait"`
+}
+
+// MarshalJSON implements json.Marshaler.
+//
+// CGroupStats is encoded as a JSON object with a "version" field, currently
+// 1, and one field per CGroupStats field in snake case.
+func (s CGroupStats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(cgroupStatsJSON{
+		Version:         jsonVersion,
+		Sleeping:        s.Sleeping,
+		Running:         s.Running,
+		Stopped:         s.Stopped,
+		Uninterruptible: s.Uninterruptible,
+		IOWait:          s.IOWait,
+	})
+}
+
+// UnmarshalJSON implements json.Unmarshaler, decoding the encoding produced
+// by MarshalJSON. Unknown fields are ignored, and an error is returned if the
+// version is missing or unsupported.
+func (s *CGroupStats) UnmarshalJSON(b []byte) error {
+	var cj cgroupStatsJSON
+	if err := json.Unmarshal(b, &cj); err != nil {
+		return err
+	}
+
+	if err := checkJSONVersion("CGroupStats", cj.Version); err != nil {
+		return err
+	}
+
+	*s = CGroupStats{
+		Sleeping:        cj.Sleeping,
+		Running:         cj.Running,
+		Stopped:         cj.Stopped,
+		Uninterruptible: cj.Uninterruptible,
+		IOWait:          cj.IOWait,
+	}
+
+	return nil
+}
+
+// checkJSONVersion verifies that the JSON encoding of typ uses a supported
+// version.
+func checkJSONVersion(typ string, version int) error {
+	if version != jsonVersion {
+		return fmt.Errorf("taskstats: unsupported %s JSON version %d", typ, version)
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package taskstats
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStatsJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		s    Stats
+		b    string
+	}{
+		{
+			name: "zero",
+			b: `{"version":1,"pid":0,"ppid":0,"tgid":0,"uid":0,"gid":0,"comm":"","exit_code":0,"flags":0,"elapsed_ns":0,"group_elapsed_ns":0,"user_cpu_ns":0,"system_cpu_ns":0,` +
+				`"minor_page_faults":0,"major_page_faults":0,"cpu_delay_count":0,"cpu_delay_ns":0,` +
+				`"block_io_delay_count":0,"block_io_delay_ns":0,"swap_in_delay_count":0,"swap_in_delay_ns":0,` +
+				`"free_pages_delay_count":0,"free_pages_delay_ns":0,"thrashing_delay_count":0,"thrashing_delay_ns":0,` +
+				`"peak_rss_bytes":0,"peak_virtual_memory_bytes":0,"read_bytes":0,"write_bytes":0}`,
+		},
+		{
+			name: "full",
+			s: Stats{
+				PID:                 2,
+				PPID:                1,
+				TGID:                2,
+				UID:                 1000,
+				GID:                 100,
+				Comm:                "sh",
+				ExitCode:            256,
+				Flags:               AccountingForked | AccountingKilled,
+				BeginTime:           time.Date(2024, time.March, 1, 12, 30, 0, 5, time.UTC),
+				ElapsedTime:         time.Minute,
+				GroupElapsedTime:    2 * time.Minute,
+				UserCPUTime:         3 * time.Second,
+				SystemCPUTime:       4 * time.Millisecond,
+				MinorPageFaults:     5,
+				MajorPageFaults:     6,
+				CPUDelayCount:       7,
+				CPUDelay:            8,
+				BlockIODelayCount:   9,
+				BlockIODelay:        10,
+				SwapInDelayCount:    11,
+				SwapInDelay:         12,
+				FreePagesDelayCount: 13,
+				FreePagesDelay:      14,
+				ThrashingDelayCount: 15,
+				ThrashingDelay:      16,
+				PeakRSS:             4096,
+				PeakVirtualMemory:   8192,
+				ReadBytes:           512,
+				WriteBytes:          1024,
+			},
+			b: `{"version":1,"pid":2,"ppid":1,"tgid":2,"uid":1000,"gid":100,"comm":"sh","exit_code":256,"flags":17,"begin_time":"2024-03-01T12:30:00.000000005Z",` +
+				`"elapsed_ns":60000000000,"group_elapsed_ns":120000000000,"user_cpu_ns":3000000000,"system_cpu_ns":4000000,` +
+				`"minor_page_faults":5,"major_page_faults":6,"cpu_delay_count":7,"cpu_delay_ns":8,` +
+				`"block_io_delay_count":9,"block_io_delay_ns":10,"swap_in_delay_count":11,"swap_in_delay_ns":12,` +
+				`"free_pages_delay_count":13,"free_pages_delay_ns":14,"thrashing_delay_count":15,"thrashing_delay_ns":16,` +
+				`"peak_rss_bytes":4096,"peak_virtual_memory_bytes":8192,"read_bytes":512,"write_bytes":1024}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := json.Marshal(&tt.s)
+			if err != nil {
+				t.Fatalf("failed to marshal: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.b, string(b)); diff != "" {
+				t.Fatalf("unexpected JSON (-want +got):\n%s", diff)
+			}
+
+			var s Stats
+			if err := json.Unmarshal(b, &s); err != nil {
+				t.Fatalf("failed to unmarshal: %v", err)
+			}
+
+			if diff := cmp.Diff(tt.s, s); diff != "" {
+				t.Fatalf("unexpected Stats (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCGroupStatsJSON(t *testing.T) {
+	cs := CGroupStats{Sleeping: 1, Running: 2, Stopped: 3, Uninterruptible: 4, IOWait: 5}
+
+	b, err := json.Marshal(cs)
+	if err != nil {
+		t.Fatalf("failed to marshal: %v", err)
+	}
+
+	want := `{"version":1,"sleeping":1,"running":2,"stopped":3,"uninterruptible":4,"io_wait":5}`
+	if diff := cmp.Diff(want, string(b)); diff != "" {
+		t.Fatalf("unexpected JSON (-want +got):\n%s", diff)
+	}
+
+	var got CGroupStats
+	if err := json.Unmarshal(b, &got); err != nil {
+		t.Fatalf("failed to unmarshal: %v", err)
+	}
+
+	if diff := cmp.Diff(cs, got); diff != "" {
+		t.Fatalf("unexpected CGroupStats (-want +got):\n%s", diff)
+	}
+}
+
+func TestJSONUnmarshalError(t *testing.T) {
+	tests := []struct {
+		name string
+		v    any
+		b    string
+	}{
+		{
+			name: "stats no version",
+			v:    &Stats{},
+			b:    `{"pid":1}`,
+		},
+		{
+			name: "stats future version",
+			v:    &Stats{},
+			b:    `{"version":2,"pid":1}`,
+		},
+		{
+			name: "stats bad begin time",
+			v:    &Stats{},
+			b:    `{"version":1,"begin_time":"yesterday"}`,
+		},
+		{
+			name: "cgroup stats future version",
+			v:    &CGroupStats{},
+			b:    `{"version":2}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := json.Unmarshal([]byte(tt.b), tt.v); err == nil {
+				t.Fatal("expected an error, but none occurred")
+			}
+		})
+	}
+}
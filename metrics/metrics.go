@@ -0,0 +1,240 @@
+// Package metrics exposes taskstats statistics through a stable set of named
+// metrics, in the style of the standard library's runtime/metrics package.
+//
+// Each metric is identified by a name of the form "/path/to/metric:unit",
+// following the conventions of runtime/metrics, so that generic metric
+// exporters can discover and read taskstats values using All and Read
+// without knowledge of the taskstats.Stats structure.
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mdlayher/taskstats"
+)
+
+// A ValueKind is a tag for a metric Value which indicates its type.
+type ValueKind int
+
+// Possible ValueKind values.
+const (
+	// KindBad indicates that a Value has no type, because the metric it was
+	// read for is unknown.
+	KindBad ValueKind = iota
+
+	// KindUint64 indicates that a Value is a uint64.
+	KindUint64
+
+	// KindFloat64 indicates that a Value is a float64.
+	KindFloat64
+)
+
+// A Description describes a metric.
+type Description struct {
+	// Name is the full name of the metric, including its unit.
+	Name string
+
+	// Unit is the unit of the metric, which is the portion of Name following
+	// the colon.
+	Unit string
+
+	// Description is an English description of the metric.
+	Description string
+
+	// Kind is the kind of Value reported for the metric.
+	Kind ValueKind
+
+	// Cumulative reports whether the metric only increases over the
+	// lifetime of a process, so that the rate of change between two reads
+	// is meaningful.
+	Cumulative bool
+}
+
+// A Sample captures a single metric value.
+type Sample struct {
+	// Name is the name of the metric to read, as reported by All.
+	Name string
+
+	// Value is the value of the metric.
+	Value Value
+}
+
+// A Value is a metric value returned by Read.
+type Value struct {
+	kind ValueKind
+	u    uint64
+	f    float64
+}
+
+// Kind returns the kind of the value.
+func (v Value) Kind() ValueKind {
+	return v.kind
+}
+
+// Uint64 returns the value as a uint64. It panics if the kind is not
+// KindUint64.
+func (v Value) Uint64() uint64 {
+	if v.kind != KindUint64 {
+		panic("metrics: called Uint64 on non-uint64 metric value")
+	}
+
+	return v.u
+}
+
+// Float64 returns the value as a float64. It panics if the kind is not
+// KindFloat64.
+func (v Value) Float64() float64 {
+	if v.kind != KindFloat64 {
+		panic("metrics: called Float64 on non-float64 metric value")
+	}
+
+	return v.f
+}
+
+// A metric is a metric's description and the function which reads its value
+// from Stats.
+type metric struct {
+	Description
+	value func(s *taskstats.Stats) Value
+}
+
+// durationMetric creates a cumulative metric for a duration in seconds.
+func durationMetric(name, desc string, fn func(s *taskstats.Stats) time.Duration) metric {
+	return newMetric(name, desc, KindFloat64, func(s *taskstats.Stats) Value {
+		return Value{kind: KindFloat64, f: fn(s).Seconds()}
+	})
+}
+
+// countMetric creates a cumulative metric for a count.
+func countMetric(name, desc string, fn func(s *taskstats.Stats) uint64) metric {
+	return newMetric(name, desc, KindUint64, func(s *taskstats.Stats) Value {
+		return Value{kind: KindUint64, u: fn(s)}
+	})
+}
+
+// newMetric creates a cumulative metric, deriving its unit from name.
+func newMetric(name, desc string, kind ValueKind, value func(s *taskstats.Stats) Value) metric {
+	return metric{
+		Description: Description{
+			Name:        name,
+			Unit:        name[strings.IndexByte(name, ':')+1:],
+			Description: desc,
+			Kind:        kind,
+			Cumulative:  true,
+		},
+		value: value,
+	}
+}
+
+// all contains every supported metric, keyed by name.
+var all = func() map[string]metric {
+	ms := []metric{
+		durationMetric("/taskstats/elapsed:seconds",
+			"Wall clock time elapsed since the task started.",
+			func(s *taskstats.Stats) time.Duration { return s.ElapsedTime }),
+		durationMetric("/taskstats/cpu/user:seconds",
+			"CPU time spent running in user mode.",
+			func(s *taskstats.Stats) time.Duration { return s.UserCPUTime }),
+		durationMetric("/taskstats/cpu/system:seconds",
+			"CPU time spent running in kernel mode.",
+			func(s *taskstats.Stats) time.Duration { return s.SystemCPUTime }),
+		countMetric("/taskstats/faults/minor:faults",
+			"Page faults which did not require loading a page from disk.",
+			func(s *taskstats.Stats) uint64 { return s.MinorPageFaults }),
+		countMetric("/taskstats/faults/major:faults",
+			"Page faults which required loading a page from disk.",
+			func(s *taskstats.Stats) uint64 { return s.MajorPageFaults }),
+		countMetric("/taskstats/io/read:bytes",
+			"Bytes read from storage.",
+			func(s *taskstats.Stats) uint64 { return s.ReadBytes }),
+		countMetric("/taskstats/io/write:bytes",
+			"Bytes written to storage.",
+			func(s *taskstats.Stats) uint64 { return s.WriteBytes }),
+		countMetric("/taskstats/delay/cpu/count:delays",
+			"Number of times tasks waited for a CPU while runnable.",
+			func(s *taskstats.Stats) uint64 { return s.CPUDelayCount }),
+		durationMetric("/taskstats/delay/cpu/total:seconds",
+			"Time spent waiting for a CPU while runnable.",
+			func(s *taskstats.Stats) time.Duration { return s.CPUDelay }),
+		countMetric("/taskstats/delay/blkio/count:delays",
+			"Number of times tasks waited for synchronous block I/O to complete.",
+			func(s *taskstats.Stats) uint64 { return s.BlockIODelayCount }),
+		durationMetric("/taskstats/delay/blkio/total:seconds",
+			"Time spent waiting for synchronous block I/O to complete.",
+			func(s *taskstats.Stats) time.Duration { return s.BlockIODelay }),
+		countMetric("/taskstats/delay/swapin/count:delays",
+			"Number of times tasks waited for pages to be swapped in.",
+			func(s *taskstats.Stats) uint64 { return s.SwapInDelayCount }),
+		durationMetric("/taskstats/delay/swapin/total:seconds",
+			"Time spent waiting for pages to be swapped in.",
+			func(s *taskstats.Stats) time.Duration { return s.SwapInDelay }),
+		countMetric("/taskstats/delay/freepages/count:delays",
+			"Number of times tasks waited for memory reclaim.",
+			func(s *taskstats.Stats) uint64 { return s.FreePagesDelayCount }),
+		durationMetric("/taskstats/delay/freepages/total:seconds",
+			"Time spent waiting for memory reclaim.",
+			func(s *taskstats.Stats) time.Duration { return s.FreePagesDelay }),
+		countMetric("/taskstats/delay/thrashing/count:delays",
+			"Number of times tasks waited for thrashing pages to be read.",
+			func(s *taskstats.Stats) uint64 { return s.ThrashingDelayCount }),
+		durationMetric("/taskstats/delay/thrashing/total:seconds",
+			"Time spent waiting for thrashing pages to be read.",
+			func(s *taskstats.Stats) time.Duration { return s.ThrashingDelay }),
+	}
+
+	m := make(map[string]metric, len(ms))
+	for _, v := range ms {
+		m[v.Name] = v
+	}
+
+	return m
+}()
+
+// All returns descriptions of all supported metrics, ordered by name.
+func All() []Description {
+	ds := make([]Description, 0, len(all))
+	for _, m := range all {
+		ds = append(ds, m.Description)
+	}
+
+	sort.Slice(ds, func(i, j int) bool {
+		return ds[i].Name < ds[j].Name
+	})
+
+	return ds
+}
+
+// Read retrieves statistics for the current process using c, and populates
+// each Sample in m with the value of the metric it names. Samples naming
+// unknown metrics are given a Value of KindBad.
+//
+// The statistics are those reported by taskstats.Client.Self, so CPU time,
+// page faults and I/O are summed over the threads of the process.
+//
+// The statistics are retrieved once per call, so all samples are consistent
+// with one another.
+func Read(c *taskstats.Client, m []Sample) error {
+	s, err := c.Self()
+	if err != nil {
+		return err
+	}
+
+	ReadStats(s, m)
+	return nil
+}
+
+// ReadStats is like Read, but populates m using previously retrieved
+// statistics, such as those of another process or an exited process.
+func ReadStats(s *taskstats.Stats, m []Sample) {
+	for i := range m {
+		mt, ok := all[m[i].Name]
+		if !ok {
+			m[i].Value = Value{}
+			continue
+		}
+
+		m[i].Value = mt.value(s)
+	}
+}
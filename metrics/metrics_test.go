@@ -0,0 +1,128 @@
+package metrics_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/taskstats"
+	"github.com/mdlayher/taskstats/metrics"
+)
+
+func TestAll(t *testing.T) {
+	ds := metrics.All()
+	if len(ds) == 0 {
+		t.Fatal("no metrics found")
+	}
+
+	for i, d := range ds {
+		if i > 0 && ds[i-1].Name >= d.Name {
+			t.Fatalf("metrics not sorted by name: %q >= %q", ds[i-1].Name, d.Name)
+		}
+
+		if !strings.HasPrefix(d.Name, "/taskstats/") || !strings.HasSuffix(d.Name, ":"+d.Unit) {
+			t.Fatalf("malformed metric name %q with unit %q", d.Name, d.Unit)
+		}
+
+		if d.Kind == metrics.KindBad || d.Description == "" {
+			t.Fatalf("incomplete description: %+v", d)
+		}
+	}
+}
+
+func TestReadStats(t *testing.T) {
+	s := &taskstats.Stats{
+		UserCPUTime:     1500 * time.Millisecond,
+		MajorPageFaults: 3,
+		CPUDelayCount:   10,
+		CPUDelay:        250 * time.Millisecond,
+	}
+
+	m := []metrics.Sample{
+		{Name: "/taskstats/cpu/user:seconds"},
+		{Name: "/taskstats/faults/major:faults"},
+		{Name: "/taskstats/delay/cpu/count:delays"},
+		{Name: "/taskstats/delay/cpu/total:seconds"},
+		{Name: "/taskstats/delay/blkio/total:seconds"},
+		{Name: "/taskstats/unknown:bytes"},
+	}
+
+	metrics.ReadStats(s, m)
+
+	type result struct {
+		Kind metrics.ValueKind
+		U    uint64
+		F    float64
+	}
+
+	var got []result
+	for _, v := range m {
+		r := result{Kind: v.Value.Kind()}
+		switch r.Kind {
+		case metrics.KindUint64:
+			r.U = v.Value.Uint64()
+		case metrics.KindFloat64:
+			r.F = v.Value.Float64()
+		}
+
+		got = append(got, r)
+	}
+
+	want := []result{
+		{Kind: metrics.KindFloat64, F: 1.5},
+		{Kind: metrics.KindUint64, U: 3},
+		{Kind: metrics.KindUint64, U: 10},
+		{Kind: metrics.KindFloat64, F: 0.25},
+		{Kind: metrics.KindFloat64},
+		{Kind: metrics.KindBad},
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected values (-want +got):\n%s", diff)
+	}
+}
+
+func TestReadStatsAll(t *testing.T) {
+	// Every described metric can be read with its described kind.
+	var m []metrics.Sample
+	for _, d := range metrics.All() {
+		m = append(m, metrics.Sample{Name: d.Name})
+	}
+
+	metrics.ReadStats(&taskstats.Stats{}, m)
+
+	for i, d := range metrics.All() {
+		if got := m[i].Value.Kind(); got != d.Kind {
+			t.Fatalf("unexpected kind for %q: %v, want: %v", d.Name, got, d.Kind)
+		}
+	}
+}
+
+func TestRead(t *testing.T) {
+	c, err := taskstats.New()
+	if err != nil {
+		if os.IsPermission(err) {
+			t.Skipf("taskstats requires elevated permission: %v", err)
+		}
+
+		t.Skipf("failed to open client: %v", err)
+	}
+	defer c.Close()
+
+	m := []metrics.Sample{{Name: "/taskstats/faults/minor:faults"}}
+	if err := metrics.Read(c, m); err != nil {
+		if os.IsPermission(err) {
+			t.Skipf("taskstats requires elevated permission: %v", err)
+		}
+
+		t.Fatalf("failed to read metrics: %v", err)
+	}
+
+	// Page faults are only reported for individual threads, so they must be
+	// summed for the process to be nonzero.
+	if m[0].Value.Uint64() == 0 {
+		t.Fatal("expected nonzero minor page faults for the current process")
+	}
+}
@@ -0,0 +1,389 @@
+// Package otlp pushes taskstats statistics to an OpenTelemetry collector as
+// metrics, using the OTLP/HTTP protocol with JSON encoding.
+//
+// OpenTelemetry process semantic convention names are used where they exist:
+//   - process.cpu.time, with a cpu.mode attribute of user or system
+//   - process.uptime
+//   - process.paging.faults, with a system.paging.fault.type attribute of
+//     major or minor
+//   - process.disk.io, with a disk.io.direction attribute of read or write
+//
+// Delay accounting statistics have no semantic convention, and are reported
+// as taskstats.delay.time and taskstats.delay.count, with a
+// taskstats.delay.class attribute of cpu, block_io, swap_in, free_pages, or
+// thrashing. Each data point is identified by the process.pid attribute, and
+// by the process.parent_pid and process.executable.name attributes when they
+// are known.
+//
+// Samples are expected to describe whole processes, as collected by a
+// taskstats.Collector using taskstats.Client.Process, so that page faults and
+// disk I/O are summed over the threads of each process. Uptime is the time
+// elapsed since the thread group leader started.
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/mdlayher/taskstats"
+)
+
+// scopeName is the instrumentation scope reported with each metric.
+const scopeName = "github.com/mdlayher/taskstats/otlp"
+
+// A Config configures an Exporter.
+type Config struct {
+	// Endpoint is the URL to which metrics are sent, such as
+	// "http://localhost:4318/v1/metrics".
+	Endpoint string
+
+	// Headers, if set, are added to each request, such as for
+	// authentication.
+	Headers map[string]string
+
+	// Resource, if set, contains the attributes of the resource which
+	// produced the metrics, such as "service.name" and "host.name".
+	Resource map[string]string
+
+	// Client, if set, is used to send requests. If nil, a client with a
+	// timeout of 10 seconds is used.
+	Client *http.Client
+
+	// OnError, if set, is called by Run with each error which occurs while
+	// sending metrics. Run continues after such errors.
+	OnError func(err error)
+}
+
+// An Exporter sends taskstats statistics to an OTLP/HTTP endpoint.
+type Exporter struct {
+	cfg    Config
+	client *http.Client
+}
+
+// New creates an Exporter using cfg.
+func New(cfg Config) (*Exporter, error) {
+	if _, err := url.ParseRequestURI(cfg.Endpoint); err != nil {
+		return nil, fmt.Errorf("otlp: invalid endpoint: %w", err)
+	}
+
+	client := cfg.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	return &Exporter{
+		cfg:    cfg,
+		client: client,
+	}, nil
+}
+
+// Run runs c, sending the samples from each of its collections until ctx is
+// canceled or c fails, and then returns the error returned by c.Run.
+//
+// Collections are sent in the background, so a slow endpoint causes
+// collections to be skipped rather than delaying c.
+func (e *Exporter) Run(ctx context.Context, c *taskstats.Collector) error {
+	samplesC, unsubscribe := c.Subscribe(1)
+	defer unsubscribe()
+
+	errC := make(chan error, 1)
+	go func() { errC <- c.Run(ctx) }()
+
+	for {
+		select {
+		case err := <-errC:
+			return err
+		case samples := <-samplesC:
+			if err := e.Export(ctx, samples); err != nil && e.cfg.OnError != nil {
+				e.cfg.OnError(err)
+			}
+		}
+	}
+}
+
+// Export sends samples to the endpoint. The cumulative statistics of each
+// sample are sent, rather than deltas.
+func (e *Exporter) Export(ctx context.Context, samples []taskstats.Sample) error {
+	b, err := json.Marshal(newRequest(e.cfg.Resource, samples))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.cfg.Endpoint, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	res, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// Include the start of the body, which describes the failure.
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return fmt.Errorf("otlp: endpoint returned %s: %s", res.Status, bytes.TrimSpace(body))
+	}
+
+	return nil
+}
+
+// newRequest builds an export request for samples.
+func newRequest(resourceAttrs map[string]string, samples []taskstats.Sample) exportRequest {
+	keys := make([]string, 0, len(resourceAttrs))
+	for k := range resourceAttrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var res resource
+	for _, k := range keys {
+		res.Attributes = append(res.Attributes, stringAttr(k, resourceAttrs[k]))
+	}
+
+	var (
+		cpuTime    = newSum("process.cpu.time", "s", "Total CPU seconds broken down by different CPU modes.")
+		uptime     = newGauge("process.uptime", "s", "The time the process has been running.")
+		faults     = newSum("process.paging.faults", "{fault}", "Number of page faults the process has made.")
+		diskIO     = newSum("process.disk.io", "By", "Disk bytes transferred.")
+		delayTime  = newSum("taskstats.delay.time", "s", "Time the process spent delayed waiting for a resource.")
+		delayCount = newSum("taskstats.delay.count", "{delay}", "Number of times the process was delayed waiting for a resource.")
+	)
+
+	for _, s := range samples {
+		st := s.Stats
+		if st == nil {
+			continue
+		}
+
+		p := newPoint(s)
+
+		cpuTime.add(p.double(st.UserCPUTime.Seconds(), stringAttr("cpu.mode", "user")))
+		cpuTime.add(p.double(st.SystemCPUTime.Seconds(), stringAttr("cpu.mode", "system")))
+
+		// The kernel reports the time elapsed since the thread group leader
+		// started, which is the process uptime even for a single thread.
+		elapsed := st.GroupElapsedTime
+		if elapsed == 0 {
+			elapsed = st.ElapsedTime
+		}
+
+		up := p.double(elapsed.Seconds())
+		up.StartTimeUnixNano = ""
+		uptime.add(up)
+
+		faults.add(p.int(st.MajorPageFaults, stringAttr("system.paging.fault.type", "major")))
+		faults.add(p.int(st.MinorPageFaults, stringAttr("system.paging.fault.type", "minor")))
+
+		diskIO.add(p.int(st.ReadBytes, stringAttr("disk.io.direction", "read")))
+		diskIO.add(p.int(st.WriteBytes, stringAttr("disk.io.direction", "write")))
+
+		if st.NoDelays {
+			continue
+		}
+
+		for _, d := range []struct {
+			class string
+			count uint64
+			total time.Duration
+		}{
+			{"cpu", st.CPUDelayCount, st.CPUDelay},
+			{"block_io", st.BlockIODelayCount, st.BlockIODelay},
+			{"swap_in", st.SwapInDelayCount, st.SwapInDelay},
+			{"free_pages", st.FreePagesDelayCount, st.FreePagesDelay},
+			{"thrashing", st.ThrashingDelayCount, st.ThrashingDelay},
+		} {
+			class := stringAttr("taskstats.delay.class", d.class)
+			delayTime.add(p.double(d.total.Seconds(), class))
+			delayCount.add(p.int(d.count, class))
+		}
+	}
+
+	var ms []metric
+	for _, m := range []metric{cpuTime, uptime, faults, diskIO, delayTime, delayCount} {
+		if m.points() > 0 {
+			ms = append(ms, m)
+		}
+	}
+
+	return exportRequest{
+		ResourceMetrics: []resourceMetrics{{
+			Resource: res,
+			ScopeMetrics: []scopeMetrics{{
+				Scope:   scope{Name: scopeName},
+				Metrics: ms,
+			}},
+		}},
+	}
+}
+
+// newPoint creates a template data point identifying the process of s.
+func newPoint(s taskstats.Sample) dataPoint {
+	st := s.Stats
+
+	attrs := []keyValue{intAttr("process.pid", int64(s.TGID))}
+	if st.PPID != 0 {
+		attrs = append(attrs, intAttr("process.parent_pid", int64(st.PPID)))
+	}
+	if st.Comm != "" {
+		attrs = append(attrs, stringAttr("process.executable.name", st.Comm))
+	}
+
+	p := dataPoint{
+		Attributes:   attrs,
+		TimeUnixNano: strconv.FormatInt(s.Time.UnixNano(), 10),
+	}
+
+	if !st.BeginTime.IsZero() {
+		p.StartTimeUnixNano = strconv.FormatInt(st.BeginTime.UnixNano(), 10)
+	}
+
+	return p
+}
+
+// double returns a copy of p with a floating point value and additional
+// attributes.
+func (p dataPoint) double(v float64, attrs ...keyValue) dataPoint {
+	p.Attributes = append(p.Attributes[:len(p.Attributes):len(p.Attributes)], attrs...)
+	p.AsDouble = &v
+	return p
+}
+
+// int returns a copy of p with an integer value and additional attributes.
+func (p dataPoint) int(v uint64, attrs ...keyValue) dataPoint {
+	p.Attributes = append(p.Attributes[:len(p.Attributes):len(p.Attributes)], attrs...)
+	p.AsInt = strconv.FormatUint(v, 10)
+	return p
+}
+
+// newSum creates a cumulative, monotonic sum metric.
+func newSum(name, unit, desc string) metric {
+	return metric{
+		Name:        name,
+		Unit:        unit,
+		Description: desc,
+		Sum: &sum{
+			AggregationTemporality: aggregationTemporalityCumulative,
+			IsMonotonic:            true,
+		},
+	}
+}
+
+// newGauge creates a gauge metric.
+func newGauge(name, unit, desc string) metric {
+	return metric{
+		Name:        name,
+		Unit:        unit,
+		Description: desc,
+		Gauge:       &gauge{},
+	}
+}
+
+// add adds a data point to m.
+func (m metric) add(p dataPoint) {
+	if m.Sum != nil {
+		m.Sum.DataPoints = append(m.Sum.DataPoints, p)
+	} else {
+		m.Gauge.DataPoints = append(m.Gauge.DataPoints, p)
+	}
+}
+
+// points returns the number of data points in m.
+func (m metric) points() int {
+	if m.Sum != nil {
+		return len(m.Sum.DataPoints)
+	}
+
+	return len(m.Gauge.DataPoints)
+}
+
+// stringAttr creates a string attribute.
+func stringAttr(key, value string) keyValue {
+	return keyValue{Key: key, Value: anyValue{StringValue: &value}}
+}
+
+// intAttr creates an integer attribute.
+func intAttr(key string, value int64) keyValue {
+	return keyValue{Key: key, Value: anyValue{IntValue: strconv.FormatInt(value, 10)}}
+}
+
+// aggregationTemporalityCumulative is the OTLP value for cumulative
+// aggregation temporality.
+const aggregationTemporalityCumulative = 2
+
+// The following types are the OTLP/HTTP JSON encoding of an
+// ExportMetricsServiceRequest, limited to the fields used by this package.
+// 64-bit integers are encoded as strings, as required by the protobuf JSON
+// mapping.
+
+type exportRequest struct {
+	ResourceMetrics []resourceMetrics `json:"resourceMetrics"`
+}
+
+type resourceMetrics struct {
+	Resource     resource       `json:"resource"`
+	ScopeMetrics []scopeMetrics `json:"scopeMetrics"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes,omitempty"`
+}
+
+type scopeMetrics struct {
+	Scope   scope    `json:"scope"`
+	Metrics []metric `json:"metrics"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type metric struct {
+	Name        string `json:"name"`
+	Unit        string `json:"unit"`
+	Description string `json:"description"`
+	Sum         *sum   `json:"sum,omitempty"`
+	Gauge       *gauge `json:"gauge,omitempty"`
+}
+
+type sum struct {
+	AggregationTemporality int         `json:"aggregationTemporality"`
+	IsMonotonic            bool        `json:"isMonotonic"`
+	DataPoints             []dataPoint `json:"dataPoints"`
+}
+
+type gauge struct {
+	DataPoints []dataPoint `json:"dataPoints"`
+}
+
+type dataPoint struct {
+	Attributes        []keyValue `json:"attributes,omitempty"`
+	StartTimeUnixNano string     `json:"startTimeUnixNano,omitempty"`
+	TimeUnixNano      string     `json:"timeUnixNano"`
+	AsDouble          *float64   `json:"asDouble,omitempty"`
+	AsInt             string     `json:"asInt,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    string  `json:"intValue,omitempty"`
+}
@@ -0,0 +1,185 @@
+package otlp
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/taskstats"
+)
+
+func TestExporterExport(t *testing.T) {
+	var (
+		got    exportRequest
+		header http.Header
+	)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != "/v1/metrics" {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		header = r.Header
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}))
+	defer srv.Close()
+
+	e, err := New(Config{
+		Endpoint: srv.URL + "/v1/metrics",
+		Headers:  map[string]string{"Authorization": "Bearer foo"},
+		Resource: map[string]string{"service.name": "test"},
+	})
+	if err != nil {
+		t.Fatalf("failed to create exporter: %v", err)
+	}
+
+	samples := []taskstats.Sample{{
+		TGID: 1,
+		Time: time.Unix(200, 0),
+		Stats: &taskstats.Stats{
+			PPID:             2,
+			Comm:             "foo",
+			BeginTime:        time.Unix(100, 0),
+			ElapsedTime:      2 * time.Second,
+			GroupElapsedTime: 3 * time.Second,
+			UserCPUTime:      1500 * time.Millisecond,
+			SystemCPUTime:    500 * time.Millisecond,
+			MinorPageFaults:  10,
+			MajorPageFaults:  1,
+			CPUDelayCount:    3,
+			CPUDelay:         time.Second,
+			ReadBytes:        4096,
+			WriteBytes:       8192,
+		},
+	}}
+
+	if err := e.Export(context.Background(), samples); err != nil {
+		t.Fatalf("failed to export: %v", err)
+	}
+
+	if diff := cmp.Diff("application/json", header.Get("Content-Type")); diff != "" {
+		t.Fatalf("unexpected content type (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff("Bearer foo", header.Get("Authorization")); diff != "" {
+		t.Fatalf("unexpected authorization (-want +got):\n%s", diff)
+	}
+
+	if len(got.ResourceMetrics) != 1 || len(got.ResourceMetrics[0].ScopeMetrics) != 1 {
+		t.Fatalf("unexpected request structure: %+v", got)
+	}
+
+	rm := got.ResourceMetrics[0]
+	if diff := cmp.Diff([]keyValue{stringAttr("service.name", "test")}, rm.Resource.Attributes); diff != "" {
+		t.Fatalf("unexpected resource attributes (-want +got):\n%s", diff)
+	}
+
+	sm := rm.ScopeMetrics[0]
+	if diff := cmp.Diff(scopeName, sm.Scope.Name); diff != "" {
+		t.Fatalf("unexpected scope (-want +got):\n%s", diff)
+	}
+
+	var names []string
+	metrics := make(map[string]metric)
+	for _, m := range sm.Metrics {
+		names = append(names, m.Name)
+		metrics[m.Name] = m
+	}
+
+	wantNames := []string{
+		"process.cpu.time",
+		"process.uptime",
+		"process.paging.faults",
+		"process.disk.io",
+		"taskstats.delay.time",
+		"taskstats.delay.count",
+	}
+	if diff := cmp.Diff(wantNames, names); diff != "" {
+		t.Fatalf("unexpected metrics (-want +got):\n%s", diff)
+	}
+
+	user := 1.5
+	wantCPU := dataPoint{
+		Attributes: []keyValue{
+			intAttr("process.pid", 1),
+			intAttr("process.parent_pid", 2),
+			stringAttr("process.executable.name", "foo"),
+			stringAttr("cpu.mode", "user"),
+		},
+		StartTimeUnixNano: "100000000000",
+		TimeUnixNano:      "200000000000",
+		AsDouble:          &user,
+	}
+
+	cpu := metrics["process.cpu.time"].Sum
+	if diff := cmp.Diff(aggregationTemporalityCumulative, cpu.AggregationTemporality); diff != "" {
+		t.Fatalf("unexpected temporality (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(wantCPU, cpu.DataPoints[0]); diff != "" {
+		t.Fatalf("unexpected CPU time point (-want +got):\n%s", diff)
+	}
+
+	// Uptime is that of the thread group leader.
+	up := metrics["process.uptime"].Gauge.DataPoints[0]
+	if up.AsDouble == nil || *up.AsDouble != 3 {
+		t.Fatalf("unexpected uptime point: %+v", up)
+	}
+
+	var reads string
+	for _, p := range metrics["process.disk.io"].Sum.DataPoints {
+		if cmp.Equal(p.Attributes[len(p.Attributes)-1], stringAttr("disk.io.direction", "read")) {
+			reads = p.AsInt
+		}
+	}
+	if diff := cmp.Diff("4096", reads); diff != "" {
+		t.Fatalf("unexpected read bytes (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(5, len(metrics["taskstats.delay.count"].Sum.DataPoints)); diff != "" {
+		t.Fatalf("unexpected number of delay classes (-want +got):\n%s", diff)
+	}
+}
+
+func TestExporterExportNoDelays(t *testing.T) {
+	req := newRequest(nil, []taskstats.Sample{{
+		TGID:  1,
+		Stats: &taskstats.Stats{NoDelays: true},
+	}})
+
+	for _, m := range req.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		if strings.HasPrefix(m.Name, "taskstats.delay.") {
+			t.Fatalf("unexpected delay metric without delay accounting: %s", m.Name)
+		}
+	}
+}
+
+func TestExporterExportError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		http.Error(w, "quota exceeded", http.StatusTooManyRequests)
+	}))
+	defer srv.Close()
+
+	e, err := New(Config{Endpoint: srv.URL})
+	if err != nil {
+		t.Fatalf("failed to create exporter: %v", err)
+	}
+
+	err = e.Export(context.Background(), nil)
+	if err == nil || !strings.Contains(err.Error(), "quota exceeded") {
+		t.Fatalf("expected quota exceeded error, but got: %v", err)
+	}
+}
+
+func TestNewBadEndpoint(t *testing.T) {
+	if _, err := New(Config{Endpoint: "foo"}); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+}
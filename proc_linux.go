@@ -0,0 +1,146 @@
+//go:build linux
+// +build linux
+
+package taskstats
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"golang.org/x/sys/unix"
+)
+
+// procParents returns the PID of the parent of every running process, keyed
+// by PID, as reported by procfs. Zombie processes have already exited and are
+// omitted.
+func procParents() (map[int]int, error) {
+	des, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+
+	parents := make(map[int]int, len(des))
+	for _, de := range des {
+		pid, err := strconv.Atoi(de.Name())
+		if err != nil {
+			// Not a process directory.
+			continue
+		}
+
+		b, err := os.ReadFile(filepath.Join("/proc", de.Name(), "stat"))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) || errors.Is(err, unix.ESRCH) {
+				// Process exited while reading procfs.
+				continue
+			}
+
+			return nil, err
+		}
+
+		state, ppid, err := parseStat(b)
+		if err != nil {
+			return nil, err
+		}
+
+		if state == 'Z' || state == 'X' {
+			// Zombie or dead.
+			continue
+		}
+
+		parents[pid] = ppid
+	}
+
+	return parents, nil
+}
+
+// procThreads returns the thread IDs of the process identified by tgid, as
+// reported by procfs.
+func procThreads(tgid int) ([]int, error) {
+	des, err := os.ReadDir(filepath.Join("/proc", strconv.Itoa(tgid), "task"))
+	if err != nil {
+		return nil, err
+	}
+
+	tids := make([]int, 0, len(des))
+	for _, de := range des {
+		tid, err := strconv.Atoi(de.Name())
+		if err != nil {
+			continue
+		}
+
+		tids = append(tids, tid)
+	}
+
+	return tids, nil
+}
+
+// parseStat parses the state and parent PID from the contents of
+// /proc/[pid]/stat.
+func parseStat(b []byte) (byte, int, error) {
+	// The command name is enclosed in parentheses and may itself contain
+	// spaces and parentheses, so parse fields after the final one.
+	i := bytes.LastIndexByte(b, ')')
+	if i == -1 {
+		return 0, 0, fmt.Errorf("taskstats: malformed process stat: %q", b)
+	}
+
+	// Fields after the command: state, ppid, ...
+	fields := bytes.Fields(b[i+1:])
+	if len(fields) < 2 {
+		return 0, 0, fmt.Errorf("taskstats: malformed process stat: %q", b)
+	}
+
+	ppid, err := strconv.Atoi(string(fields[1]))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return fields[0][0], ppid, nil
+}
+
+// procStartTime returns the start time of the process identified by pid, in
+// clock ticks since boot, as reported by procfs.
+func procStartTime(pid int) (uint64, error) {
+	b, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat"))
+	if err != nil {
+		if errors.Is(err, unix.ESRCH) {
+			// Process exited while reading procfs.
+			return 0, os.ErrNotExist
+		}
+
+		return 0, err
+	}
+
+	return parseStartTime(b)
+}
+
+// parseStartTime parses the start time from the contents of /proc/[pid]/stat.
+func parseStartTime(b []byte) (uint64, error) {
+	i := bytes.LastIndexByte(b, ')')
+	if i == -1 {
+		return 0, fmt.Errorf("taskstats: malformed process stat: %q", b)
+	}
+
+	// The start time is the 22nd field, and the 20th after the command.
+	fields := bytes.Fields(b[i+1:])
+	if len(fields) < 20 {
+		return 0, fmt.Errorf("taskstats: malformed process stat: %q", b)
+	}
+
+	return strconv.ParseUint(string(fields[19]), 10, 64)
+}
+
+// procComm returns the command name of the process identified by pid, as
+// reported by procfs.
+func procComm(pid int) (string, error) {
+	b, err := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "comm"))
+	if err != nil {
+		return "", err
+	}
+
+	return string(bytes.TrimSuffix(b, []byte("\n"))), nil
+}
@@ -0,0 +1,108 @@
+//go:build linux
+// +build linux
+
+package taskstats
+
+import (
+	"os"
+	"regexp"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseStat(t *testing.T) {
+	tests := []struct {
+		name  string
+		stat  string
+		state byte
+		ppid  int
+		ok    bool
+	}{
+		{
+			name:  "OK",
+			stat:  "10 (bash) S 9 10 10 34816",
+			state: 'S',
+			ppid:  9,
+			ok:    true,
+		},
+		{
+			name:  "command with spaces and parentheses",
+			stat:  "10 (a) b (c)) Z 1 10 10 0",
+			state: 'Z',
+			ppid:  1,
+			ok:    true,
+		},
+		{
+			name: "no command",
+			stat: "10 S 9",
+		},
+		{
+			name: "short",
+			stat: "10 (bash) S",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, ppid, err := parseStat([]byte(tt.stat))
+			if tt.ok && err != nil {
+				t.Fatalf("failed to parse stat: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("an error was expected, but none occurred")
+			}
+
+			if diff := cmp.Diff(tt.state, state); diff != "" {
+				t.Fatalf("unexpected state (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff(tt.ppid, ppid); diff != "" {
+				t.Fatalf("unexpected parent PID (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParseStartTime(t *testing.T) {
+	const stat = "10 (a) b) S 9 10 10 34816 10 4194304 100 0 0 0 1 2 0 0 20 0 1 0 12345 1000 100"
+
+	start, err := parseStartTime([]byte(stat))
+	if err != nil {
+		t.Fatalf("failed to parse stat: %v", err)
+	}
+
+	if diff := cmp.Diff(uint64(12345), start); diff != "" {
+		t.Fatalf("unexpected start time (-want +got):\n%s", diff)
+	}
+
+	if _, err := parseStartTime([]byte("10 (bash) S 9 10")); err == nil {
+		t.Fatal("an error was expected, but none occurred")
+	}
+}
+
+func TestCollectorTargetsNames(t *testing.T) {
+	comm, err := procComm(os.Getpid())
+	if err != nil {
+		t.Fatalf("failed to read command name: %v", err)
+	}
+
+	c := newCollector(nil, CollectorConfig{
+		Targets: Targets{
+			Names: []*regexp.Regexp{regexp.MustCompile("^" + regexp.QuoteMeta(comm) + "$")},
+		},
+	})
+
+	tgids, err := c.targets()
+	if err != nil {
+		t.Fatalf("failed to discover targets: %v", err)
+	}
+
+	for _, tgid := range tgids {
+		if tgid == os.Getpid() {
+			return
+		}
+	}
+
+	t.Fatalf("current process not found in targets: %v", tgids)
+}
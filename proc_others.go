@@ -0,0 +1,24 @@
+//go:build !linux
+// +build !linux
+
+package taskstats
+
+// procParents always returns an error.
+func procParents() (map[int]int, error) {
+	return nil, errUnimplemented
+}
+
+// procThreads always returns an error.
+func procThreads(_ int) ([]int, error) {
+	return nil, errUnimplemented
+}
+
+// procStartTime always returns an error.
+func procStartTime(_ int) (uint64, error) {
+	return 0, errUnimplemented
+}
+
+// procComm always returns an error.
+func procComm(_ int) (string, error) {
+	return "", errUnimplemented
+}
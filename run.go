@@ -0,0 +1,81 @@
+package taskstats
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+)
+
+// exitTimeout is how long Run waits for an exit notification after its
+// command has been waited for.
+const exitTimeout = 5 * time.Second
+
+// Run starts cmd, waits for it to complete, and returns the final statistics
+// of its process. If the command fails, Run returns both the statistics and
+// the command's error.
+//
+// The statistics are captured from the kernel's exit notification for the
+// process, rather than queried after the process has exited, which would
+// race with the process being reaped. Only the command's own process is
+// accounted for; use a Session to include its descendants.
+//
+// Run requires elevated privileges.
+func Run(cmd *exec.Cmd) (*Stats, error) {
+	// Listen before starting the command so its exit is not missed.
+	l, err := ListenExits(nil)
+	if err != nil {
+		return nil, err
+	}
+	defer l.Close()
+
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+
+	pid := cmd.Process.Pid
+	waitC := make(chan error, 1)
+	go func() { waitC <- cmd.Wait() }()
+
+	var (
+		exits   exitSet
+		stats   *Stats
+		waitErr error
+		waited  bool
+		timeout <-chan time.Time
+	)
+
+	for stats == nil || !waited {
+		select {
+		case e, ok := <-l.Exits():
+			if !ok {
+				if err := l.Err(); err != nil {
+					return nil, err
+				}
+
+				return nil, errors.New("taskstats: exit listener closed unexpectedly")
+			}
+
+			// Only exits of the process are needed, as its threads report
+			// its TGID.
+			if e.PID != pid && e.Stats.TGID != pid && e.TGID != pid {
+				continue
+			}
+
+			if tgid, _, ok := exits.add(e); ok && tgid == pid {
+				stats = exits.final[pid]
+			}
+		case waitErr = <-waitC:
+			waited = true
+
+			// The kernel sends the exit notification before the process can
+			// be waited for, so it should arrive promptly unless it was
+			// dropped.
+			timeout = time.After(exitTimeout)
+		case <-timeout:
+			return nil, fmt.Errorf("taskstats: no exit notification received for PID %d (%d overruns)", pid, l.Overruns())
+		}
+	}
+
+	return stats, waitErr
+}
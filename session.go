@@ -0,0 +1,378 @@
+package taskstats
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// A SessionConfig configures a Session. The zero value is valid.
+type SessionConfig struct {
+	// Exits configures the ExitListener used to receive exit notifications
+	// for the session. If nil, a default configuration is used.
+	Exits *ExitConfig
+
+	// ScanInterval sets how often procfs is scanned for new descendants of
+	// the session's processes. If zero, a default of 100 milliseconds is
+	// used.
+	ScanInterval time.Duration
+}
+
+// A SessionSummary is the combined resource usage of a process and all of its
+// descendants.
+type SessionSummary struct {
+	// Root is the TGID of the process which began the session.
+	Root int
+
+	// Processes is the number of processes whose final statistics are
+	// included in Stats, including the root process.
+	Processes int
+
+	// Missed is the number of processes which exited without an exit
+	// notification being received, usually because of ExitListener overruns,
+	// and of exited processes which could not be attributed to the session
+	// because the notification for their parent was not received. Their
+	// resource usage is absent from Stats.
+	Missed int
+
+	// Stats contains the combined final statistics of all processes. The
+	// identifiers and ElapsedTime are those of the root process.
+	Stats *Stats
+}
+
+// A Session tracks a process and all of its descendants until every one of
+// them has exited, accumulating their final statistics from exit
+// notifications.
+//
+// The kernel does not report process creation, so new descendants are
+// discovered by periodically scanning procfs and by the parent PIDs in exit
+// notifications. An exit whose parent is not yet known is held until the
+// parent is discovered by a scan or its own exit is attributed, so
+// descendants of short-lived descendants are included. A descendant which is
+// orphaned and exits before it is discovered cannot be attributed to the
+// session.
+//
+// Session requires elevated privileges.
+type Session struct {
+	l        *ExitListener
+	cmd      *exec.Cmd
+	interval time.Duration
+	s        *sessionState
+}
+
+// NewSession creates a Session which tracks the running process identified by
+// tgid and its descendants. If cfg is nil, a default configuration is used.
+//
+// Descendants which exited before the Session was created are not included.
+func NewSession(tgid int, cfg *SessionConfig) (*Session, error) {
+	return newSession(tgid, nil, cfg)
+}
+
+// StartSession starts cmd and creates a Session which tracks it and its
+// descendants. If cfg is nil, a default configuration is used.
+//
+// The Session waits for cmd, so the caller must not call cmd.Wait.
+func StartSession(cmd *exec.Cmd, cfg *SessionConfig) (*Session, error) {
+	return newSession(0, cmd, cfg)
+}
+
+// newSession creates a Session for either tgid or cmd.
+func newSession(tgid int, cmd *exec.Cmd, cfg *SessionConfig) (*Session, error) {
+	if cfg == nil {
+		cfg = &SessionConfig{}
+	}
+
+	interval := cfg.ScanInterval
+	if interval == 0 {
+		interval = 100 * time.Millisecond
+	}
+
+	// Listen before starting the command so no exits are missed.
+	l, err := ListenExits(cfg.Exits)
+	if err != nil {
+		return nil, err
+	}
+
+	if cmd != nil {
+		if err := cmd.Start(); err != nil {
+			_ = l.Close()
+			return nil, err
+		}
+
+		tgid = cmd.Process.Pid
+	}
+
+	s := &Session{
+		l:        l,
+		cmd:      cmd,
+		interval: interval,
+		s:        newSessionState(tgid),
+	}
+
+	if err := s.scan(); err != nil {
+		_ = s.Close()
+		return nil, err
+	}
+
+	if cmd == nil && s.s.members[tgid] != running {
+		_ = s.Close()
+		return nil, os.ErrNotExist
+	}
+
+	return s, nil
+}
+
+// Wait waits for the root process and all of its descendants to exit, and
+// returns their combined resource usage.
+//
+// For a Session created by StartSession, Wait also waits for the command. If
+// the command fails, Wait returns both the summary and the command's error.
+func (s *Session) Wait() (*SessionSummary, error) {
+	waitC := make(chan error, 1)
+	if s.cmd != nil {
+		go func() { waitC <- s.cmd.Wait() }()
+	}
+
+	tick := time.NewTicker(s.interval)
+	defer tick.Stop()
+
+	for !s.s.done() {
+		select {
+		case e, ok := <-s.l.Exits():
+			if !ok {
+				if err := s.l.Err(); err != nil {
+					return nil, err
+				}
+
+				return nil, errors.New("taskstats: session closed before its processes exited")
+			}
+
+			s.s.exit(e)
+		case <-tick.C:
+			if err := s.scan(); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	_ = s.l.Close()
+
+	// Discard the pending exits of unrelated processes received since the
+	// last scan.
+	if err := s.scan(); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if s.cmd != nil {
+		err = <-waitC
+	}
+
+	return s.s.summary(), err
+}
+
+// Close releases resources used by a Session. Close causes any pending call
+// to Wait to return an error.
+func (s *Session) Close() error {
+	return s.l.Close()
+}
+
+// scan discovers new descendants of the session's processes using procfs.
+func (s *Session) scan() error {
+	parents, err := procParents()
+	if err != nil {
+		return err
+	}
+
+	s.s.scan(parents)
+	return nil
+}
+
+// A member is the state of a process tracked by a Session.
+type member int
+
+// Possible member states.
+const (
+	// Seen running during the most recent scan.
+	running member = iota
+	// Absent from the most recent scan, exit notification may be in flight.
+	missing
+	// Absent from two scans without an exit notification.
+	lost
+	// Exit notification received.
+	exited
+)
+
+// A sessionState tracks the membership and accumulated statistics of a
+// Session.
+type sessionState struct {
+	root    int
+	members map[int]member
+	exits   exitSet
+
+	// pending contains the TGIDs of exited processes which could not yet be
+	// attributed to the session, keyed by the PID of their parent.
+	pending   map[int][]int
+	processes int
+	missed    int
+}
+
+// newSessionState creates a sessionState for the process identified by root.
+func newSessionState(root int) *sessionState {
+	return &sessionState{
+		root:    root,
+		members: map[int]member{root: running},
+		pending: make(map[int][]int),
+	}
+}
+
+// exit accounts for an exit notification if it belongs to the session.
+func (s *sessionState) exit(e Exit) {
+	// The exits of every thread are added, as they contribute their usage
+	// to their process.
+	tgid, first, ok := s.exits.add(e)
+	if !ok || !first {
+		return
+	}
+
+	state, known := s.members[tgid]
+	switch {
+	case known && state == lost:
+		// Notification arrived later than expected.
+		s.missed--
+	case !known:
+		// Process which exited before it was discovered by a scan. Its
+		// parent may be a descendant which has not yet been discovered
+		// either, so hold it until its parent is known.
+		ppid := s.exits.final[tgid].PPID
+		if _, ok := s.members[ppid]; !ok || ppid == 0 {
+			s.pending[ppid] = append(s.pending[ppid], tgid)
+			return
+		}
+	}
+
+	s.attribute(tgid)
+}
+
+// attribute accounts for the exited process tgid as a member of the session,
+// along with any pending exits of its children.
+func (s *sessionState) attribute(tgid int) {
+	s.members[tgid] = exited
+	s.processes++
+
+	children := s.pending[tgid]
+	delete(s.pending, tgid)
+	for _, c := range children {
+		s.attribute(c)
+	}
+}
+
+// drop discards the pending exit of the unrelated process tgid, along with any
+// pending exits of its children.
+func (s *sessionState) drop(tgid int) {
+	s.exits.remove(tgid)
+
+	children := s.pending[tgid]
+	delete(s.pending, tgid)
+	for _, c := range children {
+		s.drop(c)
+	}
+}
+
+// scan updates session membership using the parents of running processes.
+func (s *sessionState) scan(parents map[int]int) {
+	// The kernel sends exit notifications before a process becomes a zombie,
+	// so a process which no longer appears in procfs has exited. Allow one
+	// scan for a notification still in flight before declaring it lost.
+	for tgid, state := range s.members {
+		if _, ok := parents[tgid]; ok {
+			continue
+		}
+
+		switch state {
+		case running:
+			s.members[tgid] = missing
+		case missing:
+			s.members[tgid] = lost
+			s.missed++
+		}
+	}
+
+	// Add descendants of running processes until no more are found, as a
+	// single scan may find several generations at once.
+	for added := true; added; {
+		added = false
+		for pid, ppid := range parents {
+			if _, ok := s.members[pid]; ok || ppid == 0 {
+				continue
+			}
+
+			if state, ok := s.members[ppid]; ok && (state == running || state == missing) {
+				s.members[pid] = running
+				added = true
+			}
+		}
+	}
+
+	// Pending exits whose parent is now a member belong to the session, and
+	// those whose parent is a running process which is not a member do not.
+	// Others wait for the exit of their parent.
+	for ppid, tgids := range s.pending {
+		_, member := s.members[ppid]
+		_, running := parents[ppid]
+		if !member && !running {
+			continue
+		}
+
+		delete(s.pending, ppid)
+		for _, tgid := range tgids {
+			if member {
+				s.attribute(tgid)
+			} else {
+				s.drop(tgid)
+			}
+		}
+	}
+}
+
+// done reports whether all of the session's processes have exited.
+func (s *sessionState) done() bool {
+	for _, state := range s.members {
+		if state == running || state == missing {
+			return false
+		}
+	}
+
+	return true
+}
+
+// summary summarizes the accumulated statistics of the session.
+func (s *sessionState) summary() *SessionSummary {
+	stats := &Stats{PID: s.root, TGID: s.root}
+	if rs, ok := s.exits.final[s.root]; ok {
+		c := *rs
+		stats = &c
+	}
+
+	for tgid, fs := range s.exits.final {
+		if state, ok := s.members[tgid]; ok && state == exited && tgid != s.root {
+			stats.add(fs)
+		}
+	}
+
+	// Exits which are still pending belong to descendants whose parent's
+	// exit was missed, as those of unrelated processes are discarded by
+	// scans.
+	missed := s.missed
+	for _, tgids := range s.pending {
+		missed += len(tgids)
+	}
+
+	return &SessionSummary{
+		Root:      s.root,
+		Processes: s.processes,
+		Missed:    missed,
+		Stats:     stats,
+	}
+}
@@ -0,0 +1,155 @@
+package taskstats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSessionState(t *testing.T) {
+	s := newSessionState(10)
+
+	// Root forks a child which forks a grandchild; an unrelated process is
+	// also running.
+	s.scan(map[int]int{1: 0, 10: 1, 11: 10, 12: 11, 20: 1})
+
+	// A child which exited before any scan, a thread exit, and an unrelated
+	// exit.
+	s.exit(Exit{PID: 13, Stats: &Stats{PID: 13, PPID: 10, UserCPUTime: 13 * time.Second}})
+	s.exit(Exit{PID: 14, Stats: &Stats{PID: 14, PPID: 1, TGID: 10, UserCPUTime: time.Hour}})
+	s.exit(Exit{PID: 20, Stats: &Stats{PID: 20, PPID: 1, UserCPUTime: time.Hour}})
+
+	// The grandchild exits normally.
+	s.exit(Exit{PID: 12, Stats: &Stats{PID: 12, PPID: 11, UserCPUTime: 12 * time.Second}})
+	if s.done() {
+		t.Fatal("session done while processes are running")
+	}
+
+	// The child exits without a notification, and the root exits.
+	s.exit(Exit{PID: 10, Stats: &Stats{PID: 10, PPID: 1, UserCPUTime: 10 * time.Second, ElapsedTime: time.Minute}})
+	s.scan(map[int]int{1: 0, 20: 1})
+	if s.done() {
+		t.Fatal("session done while waiting for in flight notification")
+	}
+
+	s.scan(map[int]int{1: 0, 20: 1})
+	if !s.done() {
+		t.Fatal("session not done after all processes exited")
+	}
+
+	want := &SessionSummary{
+		Root:      10,
+		Processes: 3,
+		Missed:    1,
+		Stats: &Stats{
+			PID:         10,
+			PPID:        1,
+			ElapsedTime: time.Minute,
+			UserCPUTime: 35 * time.Second,
+		},
+	}
+
+	if diff := cmp.Diff(want, s.summary()); diff != "" {
+		t.Fatalf("unexpected session summary (-want +got):\n%s", diff)
+	}
+
+	// A late notification for the lost child is still accounted for.
+	s.exit(Exit{PID: 11, Stats: &Stats{PID: 11, PPID: 10, UserCPUTime: 11 * time.Second}})
+
+	want.Processes, want.Missed = 4, 0
+	want.Stats.UserCPUTime += 11 * time.Second
+
+	if diff := cmp.Diff(want, s.summary()); diff != "" {
+		t.Fatalf("unexpected session summary (-want +got):\n%s", diff)
+	}
+}
+
+func TestSessionStatePending(t *testing.T) {
+	s := newSessionState(10)
+	s.scan(map[int]int{1: 0, 10: 1, 30: 1})
+
+	exit := func(pid, ppid int, cpu time.Duration) {
+		s.exit(Exit{PID: pid, Stats: &Stats{PID: pid, PPID: ppid, UserCPUTime: cpu}})
+	}
+
+	// A child which forks two grandchildren and exits before any of them are
+	// discovered.
+	exit(21, 20, time.Second)
+	exit(22, 20, time.Second)
+	exit(20, 10, time.Second)
+
+	// A grandchild whose parent is discovered by a later scan.
+	exit(51, 50, time.Second)
+
+	// Unrelated processes whose parent, or grandparent, is running.
+	exit(31, 30, time.Hour)
+	exit(41, 40, time.Hour)
+	exit(40, 30, time.Hour)
+
+	// A process whose parent's exit is never received.
+	exit(61, 60, time.Hour)
+
+	s.scan(map[int]int{1: 0, 10: 1, 30: 1, 50: 10})
+	exit(50, 10, time.Second)
+	exit(10, 1, time.Second)
+
+	s.scan(map[int]int{1: 0, 30: 1})
+	if !s.done() {
+		t.Fatal("session not done after all processes exited")
+	}
+
+	want := &SessionSummary{
+		Root:      10,
+		Processes: 6,
+		Missed:    1,
+		Stats: &Stats{
+			PID:         10,
+			PPID:        1,
+			UserCPUTime: 6 * time.Second,
+		},
+	}
+
+	if diff := cmp.Diff(want, s.summary()); diff != "" {
+		t.Fatalf("unexpected session summary (-want +got):\n%s", diff)
+	}
+}
+
+func TestSessionStateLeaderExitsFirst(t *testing.T) {
+	s := newSessionState(10)
+	s.scan(map[int]int{1: 0, 10: 1, 11: 10})
+
+	// On kernels which do not report TGIDs, the leader of the multithreaded
+	// child is reported alone, and later with the statistics of the whole
+	// process, which are only counted once.
+	s.exit(Exit{PID: 11, Stats: &Stats{PID: 11, PPID: 10, CPUDelayCount: 97}})
+	whole := Exit{
+		PID:       12,
+		Stats:     &Stats{PID: 12, PPID: 10},
+		TGID:      11,
+		TGIDStats: &Stats{CPUDelayCount: 193},
+	}
+	s.exit(whole)
+	s.exit(whole)
+
+	s.exit(Exit{PID: 10, Stats: &Stats{PID: 10, PPID: 1, CPUDelayCount: 1}})
+	s.scan(map[int]int{1: 0})
+
+	if !s.done() {
+		t.Fatal("session not done after all processes exited")
+	}
+
+	want := &SessionSummary{
+		Root:      10,
+		Processes: 2,
+		Stats: &Stats{
+			PID:           10,
+			PPID:          1,
+			CPUDelayCount: 194,
+		},
+	}
+
+	if diff := cmp.Diff(want, s.summary()); diff != "" {
+		t.Fatalf("unexpected session summary (-want +got):\n%s", diff)
+	}
+}
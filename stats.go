@@ -11,10 +11,49 @@ type CGroupStats struct {
 	IOWait          uint64
 }
 
+// add accumulates the task-state counts reported by o into s.
+func (s *CGroupStats) add(o *CGroupStats) {
+	s.Sleeping += o.Sleeping
+	s.Running += o.Running
+	s.Stopped += o.Stopped
+	s.Uninterruptible += o.Uninterruptible
+	s.IOWait += o.IOWait
+}
+
 // Stats contains statistics for an individual task.
+//
+// TGID is only reported by kernels implementing taskstats version 11 or
+// newer, and is zero otherwise.
+//
+// BeginTime is the zero time.Time when the begin time is unknown, such as for
+// the thread group statistics reported by the kernel. GroupElapsedTime is the
+// time elapsed since the task's thread group leader started. It is only
+// reported for individual tasks by kernels implementing taskstats version 12
+// or newer, and is zero otherwise.
+//
+// Comm is the task's command name, truncated by the kernel to 15 bytes.
+// ExitCode is the task's exit status in the format reported by wait(2), and
+// is only meaningful for tasks which have exited. PeakRSS and
+// PeakVirtualMemory are the high-water marks in bytes of the resident set
+// size and virtual memory size of the task's address space. ReadBytes and
+// WriteBytes are the bytes the task caused to be read from and written to
+// storage.
+//
+// NoDelays reports whether delay accounting statistics are unavailable, such
+// as for statistics read from BSD process accounting records, in which case
+// the delay fields are zero rather than measured.
 type Stats struct {
+	PID                 int
+	PPID                int
+	TGID                int
+	UID                 uint32
+	GID                 uint32
+	Comm                string
+	ExitCode            uint32
+	Flags               AccountingFlags
 	BeginTime           time.Time
 	ElapsedTime         time.Duration
+	GroupElapsedTime    time.Duration
 	UserCPUTime         time.Duration
 	SystemCPUTime       time.Duration
 	MinorPageFaults     uint64
@@ -29,4 +68,123 @@ type Stats struct {
 	FreePagesDelay      time.Duration
 	ThrashingDelayCount uint64
 	ThrashingDelay      time.Duration
+	PeakRSS             uint64
+	PeakVirtualMemory   uint64
+	ReadBytes           uint64
+	WriteBytes          uint64
+	NoDelays            bool
+}
+
+// AccountingFlags are flags which describe how a task ran, as reported by BSD
+// process accounting.
+type AccountingFlags uint8
+
+// Possible AccountingFlags values.
+const (
+	// AccountingForked indicates that the task forked but did not exec.
+	AccountingForked AccountingFlags = 0x01
+
+	// AccountingSuperuser indicates that the task used superuser privileges.
+	AccountingSuperuser AccountingFlags = 0x02
+
+	// AccountingCoreDumped indicates that the task dumped core.
+	AccountingCoreDumped AccountingFlags = 0x08
+
+	// AccountingKilled indicates that the task was killed by a signal.
+	AccountingKilled AccountingFlags = 0x10
+
+	// AccountingGroupExited indicates that the task was the last task of its
+	// process to exit. It is only reported by kernels implementing taskstats
+	// version 12 or newer.
+	AccountingGroupExited AccountingFlags = 0x20
+)
+
+// add accumulates the resource usage reported by o into s. The identifiers,
+// ElapsedTime and GroupElapsedTime of s are retained, and BeginTime becomes
+// the earlier of the two known begin times. If either lacks delay accounting, so does the result.
+func (s *Stats) add(o *Stats) {
+	s.NoDelays = s.NoDelays || o.NoDelays
+
+	if !o.BeginTime.IsZero() && (s.BeginTime.IsZero() || o.BeginTime.Before(s.BeginTime)) {
+		s.BeginTime = o.BeginTime
+	}
+
+	s.UserCPUTime += o.UserCPUTime
+	s.SystemCPUTime += o.SystemCPUTime
+	s.MinorPageFaults += o.MinorPageFaults
+	s.MajorPageFaults += o.MajorPageFaults
+	s.CPUDelayCount += o.CPUDelayCount
+	s.CPUDelay += o.CPUDelay
+	s.BlockIODelayCount += o.BlockIODelayCount
+	s.BlockIODelay += o.BlockIODelay
+	s.SwapInDelayCount += o.SwapInDelayCount
+	s.SwapInDelay += o.SwapInDelay
+	s.FreePagesDelayCount += o.FreePagesDelayCount
+	s.FreePagesDelay += o.FreePagesDelay
+	s.ThrashingDelayCount += o.ThrashingDelayCount
+	s.ThrashingDelay += o.ThrashingDelay
+	s.ReadBytes += o.ReadBytes
+	s.WriteBytes += o.WriteBytes
+}
+
+// addUsage accumulates the CPU times, page faults and I/O reported by o into
+// s. The kernel omits them from thread group statistics.
+func (s *Stats) addUsage(o *Stats) {
+	s.UserCPUTime += o.UserCPUTime
+	s.SystemCPUTime += o.SystemCPUTime
+	s.MinorPageFaults += o.MinorPageFaults
+	s.MajorPageFaults += o.MajorPageFaults
+	s.ReadBytes += o.ReadBytes
+	s.WriteBytes += o.WriteBytes
+}
+
+// groupBeginTime returns the begin time of the thread group leader of the
+// task described by s, or the zero time if it is unknown. Like BeginTime, it
+// is only accurate to the second.
+func (s *Stats) groupBeginTime() time.Time {
+	if s.BeginTime.IsZero() || s.GroupElapsedTime == 0 {
+		return time.Time{}
+	}
+
+	return s.BeginTime.Add(s.ElapsedTime.Truncate(time.Second) - s.GroupElapsedTime.Truncate(time.Second))
+}
+
+// sub returns the change in resource usage from prev to s. The identifiers and
+// BeginTime of s are retained, and ElapsedTime becomes the time elapsed
+// between the two. If either lacks delay accounting, so does the result.
+//
+// Counters which decrease, such as when a thread whose usage was summed into
+// prev has since exited, saturate at zero rather than wrapping.
+func (s *Stats) sub(prev *Stats) *Stats {
+	d := *s
+	d.NoDelays = s.NoDelays || prev.NoDelays
+	d.ElapsedTime = monotonicSub(s.ElapsedTime, prev.ElapsedTime)
+	d.GroupElapsedTime = monotonicSub(s.GroupElapsedTime, prev.GroupElapsedTime)
+	d.UserCPUTime = monotonicSub(s.UserCPUTime, prev.UserCPUTime)
+	d.SystemCPUTime = monotonicSub(s.SystemCPUTime, prev.SystemCPUTime)
+	d.MinorPageFaults = monotonicSub(s.MinorPageFaults, prev.MinorPageFaults)
+	d.MajorPageFaults = monotonicSub(s.MajorPageFaults, prev.MajorPageFaults)
+	d.CPUDelayCount = monotonicSub(s.CPUDelayCount, prev.CPUDelayCount)
+	d.CPUDelay = monotonicSub(s.CPUDelay, prev.CPUDelay)
+	d.BlockIODelayCount = monotonicSub(s.BlockIODelayCount, prev.BlockIODelayCount)
+	d.BlockIODelay = monotonicSub(s.BlockIODelay, prev.BlockIODelay)
+	d.SwapInDelayCount = monotonicSub(s.SwapInDelayCount, prev.SwapInDelayCount)
+	d.SwapInDelay = monotonicSub(s.SwapInDelay, prev.SwapInDelay)
+	d.FreePagesDelayCount = monotonicSub(s.FreePagesDelayCount, prev.FreePagesDelayCount)
+	d.FreePagesDelay = monotonicSub(s.FreePagesDelay, prev.FreePagesDelay)
+	d.ThrashingDelayCount = monotonicSub(s.ThrashingDelayCount, prev.ThrashingDelayCount)
+	d.ThrashingDelay = monotonicSub(s.ThrashingDelay, prev.ThrashingDelay)
+	d.ReadBytes = monotonicSub(s.ReadBytes, prev.ReadBytes)
+	d.WriteBytes = monotonicSub(s.WriteBytes, prev.WriteBytes)
+
+	return &d
+}
+
+// monotonicSub returns cur - prev, or zero if cur is less than prev.
+func monotonicSub[T uint64 | time.Duration](cur, prev T) T {
+	if cur < prev {
+		return 0
+	}
+
+	return cur - prev
 }
@@ -23,9 +23,24 @@ func parseCGroupStats(cs unix.CGroupStats) (*CGroupStats, error) {
 
 // parseStats parses a raw taskstats structure into a cleaner form.
 func parseStats(ts unix.Taskstats) (*Stats, error) {
+	// The kernel reports no begin time for thread group statistics.
+	var begin time.Time
+	if ts.Ac_btime != 0 {
+		begin = time.Unix(int64(ts.Ac_btime), 0)
+	}
+
 	stats := &Stats{
-		BeginTime:           time.Unix(int64(ts.Ac_btime), 0),
+		PID:                 int(ts.Ac_pid),
+		PPID:                int(ts.Ac_ppid),
+		TGID:                int(ts.Ac_tgid),
+		UID:                 ts.Ac_uid,
+		GID:                 ts.Ac_gid,
+		Comm:                comm(ts.Ac_comm[:]),
+		ExitCode:            ts.Ac_exitcode,
+		Flags:               AccountingFlags(ts.Ac_flag),
+		BeginTime:           begin,
 		ElapsedTime:         microseconds(ts.Ac_etime),
+		GroupElapsedTime:    microseconds(ts.Ac_tgetime),
 		UserCPUTime:         microseconds(ts.Ac_utime),
 		SystemCPUTime:       microseconds(ts.Ac_stime),
 		MinorPageFaults:     ts.Ac_minflt,
@@ -40,11 +55,30 @@ func parseStats(ts unix.Taskstats) (*Stats, error) {
 		FreePagesDelay:      nanoseconds(ts.Freepages_delay_total),
 		ThrashingDelayCount: ts.Thrashing_count,
 		ThrashingDelay:      nanoseconds(ts.Thrashing_delay_total),
+		PeakRSS:             ts.Hiwater_rss * 1024,
+		PeakVirtualMemory:   ts.Hiwater_vm * 1024,
+		ReadBytes:           ts.Read_bytes,
+		WriteBytes:          ts.Write_bytes,
 	}
 
 	return stats, nil
 }
 
+// comm converts a NUL-padded command name into a string. The element type of
+// the command name varies by architecture.
+func comm[T int8 | uint8](b []T) string {
+	out := make([]byte, 0, len(b))
+	for _, c := range b {
+		if c == 0 {
+			break
+		}
+
+		out = append(out, byte(c))
+	}
+
+	return string(out)
+}
+
 // nanoseconds converts a raw number of nanoseconds into a time.Duration.
 func nanoseconds(t uint64) time.Duration {
 	return time.Duration(t) * time.Nanosecond
@@ -0,0 +1,144 @@
+// Package statsvar publishes taskstats statistics for the current process
+// using the standard library's expvar package.
+package statsvar
+
+import (
+	"encoding/json"
+	"expvar"
+	"sync"
+	"time"
+
+	"github.com/mdlayher/taskstats"
+)
+
+// DefaultMaxAge is the maximum age of cached statistics used by a Var when
+// none is specified.
+const DefaultMaxAge = time.Second
+
+var _ expvar.Var = &Var{}
+
+// A Var is an expvar.Var which renders the statistics of the current process
+// as a JSON object. Durations are rendered as floating point seconds.
+//
+// Statistics are cached, so that frequent reads of /debug/vars do not each
+// require a netlink round trip to the kernel.
+type Var struct {
+	self   func() (*taskstats.Stats, error)
+	maxAge time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	fetched time.Time
+	s       string
+}
+
+// New creates a Var which retrieves statistics for the current process using
+// c, reusing them for reads within maxAge of their retrieval. If maxAge is
+// zero, DefaultMaxAge is used.
+func New(c *taskstats.Client, maxAge time.Duration) *Var {
+	return newVar(c.Self, maxAge, time.Now)
+}
+
+// newVar creates a Var which retrieves statistics using self.
+func newVar(self func() (*taskstats.Stats, error), maxAge time.Duration, now func() time.Time) *Var {
+	if maxAge == 0 {
+		maxAge = DefaultMaxAge
+	}
+
+	return &Var{
+		self:   self,
+		maxAge: maxAge,
+		now:    now,
+	}
+}
+
+// Publish creates a Var as New does, and publishes it with expvar under
+// name. Like expvar.Publish, it panics if name is already registered.
+func Publish(name string, c *taskstats.Client, maxAge time.Duration) *Var {
+	v := New(c, maxAge)
+	expvar.Publish(name, v)
+	return v
+}
+
+// String implements expvar.Var. If statistics cannot be retrieved, the
+// object contains a single "error" field describing the failure, which is
+// cached like statistics so that a failing kernel interface is not queried
+// repeatedly.
+func (v *Var) String() string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := v.now()
+	if v.s != "" && now.Sub(v.fetched) < v.maxAge {
+		return v.s
+	}
+
+	var out any
+	s, err := v.self()
+	if err != nil {
+		out = struct {
+			Error string `json:"error"`
+		}{Error: err.Error()}
+	} else {
+		out = newStats(s)
+	}
+
+	b, err := json.Marshal(out)
+	if err != nil {
+		// Both types always marshal successfully.
+		panic("statsvar: failed to marshal JSON: " + err.Error())
+	}
+
+	v.fetched, v.s = now, string(b)
+	return v.s
+}
+
+// stats is the JSON representation of taskstats.Stats.
+type stats struct {
+	PID                 int       `json:"pid"`
+	PPID                int       `json:"ppid"`
+	TGID                int       `json:"tgid"`
+	BeginTime           time.Time `json:"begin_time"`
+	ElapsedTime         float64   `json:"elapsed_seconds"`
+	GroupElapsedTime    float64   `json:"group_elapsed_seconds"`
+	UserCPUTime         float64   `json:"user_cpu_seconds"`
+	SystemCPUTime       float64   `json:"system_cpu_seconds"`
+	MinorPageFaults     uint64    `json:"minor_page_faults"`
+	MajorPageFaults     uint64    `json:"major_page_faults"`
+	CPUDelayCount       uint64    `json:"cpu_delay_count"`
+	CPUDelay            float64   `json:"cpu_delay_seconds"`
+	BlockIODelayCount   uint64    `json:"block_io_delay_count"`
+	BlockIODelay        float64   `json:"block_io_delay_seconds"`
+	SwapInDelayCount    uint64    `json:"swap_in_delay_count"`
+	SwapInDelay         float64   `json:"swap_in_delay_seconds"`
+	FreePagesDelayCount uint64    `json:"free_pages_delay_count"`
+	FreePagesDelay      float64   `json:"free_pages_delay_seconds"`
+	ThrashingDelayCount uint64    `json:"thrashing_delay_count"`
+	ThrashingDelay      float64   `json:"thrashing_delay_seconds"`
+}
+
+// newStats converts s to its JSON representation.
+func newStats(s *taskstats.Stats) stats {
+	return stats{
+		PID:                 s.PID,
+		PPID:                s.PPID,
+		TGID:                s.TGID,
+		BeginTime:           s.BeginTime,
+		ElapsedTime:         s.ElapsedTime.Seconds(),
+		GroupElapsedTime:    s.GroupElapsedTime.Seconds(),
+		UserCPUTime:         s.UserCPUTime.Seconds(),
+		SystemCPUTime:       s.SystemCPUTime.Seconds(),
+		MinorPageFaults:     s.MinorPageFaults,
+		MajorPageFaults:     s.MajorPageFaults,
+		CPUDelayCount:       s.CPUDelayCount,
+		CPUDelay:            s.CPUDelay.Seconds(),
+		BlockIODelayCount:   s.BlockIODelayCount,
+		BlockIODelay:        s.BlockIODelay.Seconds(),
+		SwapInDelayCount:    s.SwapInDelayCount,
+		SwapInDelay:         s.SwapInDelay.Seconds(),
+		FreePagesDelayCount: s.FreePagesDelayCount,
+		FreePagesDelay:      s.FreePagesDelay.Seconds(),
+		ThrashingDelayCount: s.ThrashingDelayCount,
+		ThrashingDelay:      s.ThrashingDelay.Seconds(),
+	}
+}
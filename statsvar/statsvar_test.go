@@ -0,0 +1,74 @@
+package statsvar
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/mdlayher/taskstats"
+)
+
+func TestVarString(t *testing.T) {
+	var (
+		calls int
+		now   = time.Unix(1000, 0)
+	)
+
+	self := func() (*taskstats.Stats, error) {
+		calls++
+		if calls == 3 {
+			return nil, errors.New("netlink failure")
+		}
+
+		return &taskstats.Stats{
+			PID:         10,
+			TGID:        10,
+			BeginTime:   time.Unix(100, 0).UTC(),
+			UserCPUTime: time.Duration(calls) * 1500 * time.Millisecond,
+		}, nil
+	}
+
+	v := newVar(self, 5*time.Second, func() time.Time { return now })
+
+	read := func() map[string]any {
+		t.Helper()
+
+		var m map[string]any
+		if err := json.Unmarshal([]byte(v.String()), &m); err != nil {
+			t.Fatalf("failed to unmarshal JSON: %v", err)
+		}
+
+		return m
+	}
+
+	first := read()
+	if diff := cmp.Diff(1.5, first["user_cpu_seconds"]); diff != "" {
+		t.Fatalf("unexpected user CPU time (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff("1970-01-01T00:01:40Z", first["begin_time"]); diff != "" {
+		t.Fatalf("unexpected begin time (-want +got):\n%s", diff)
+	}
+
+	// Within the maximum age, the cached statistics are reused.
+	now = now.Add(4 * time.Second)
+	if diff := cmp.Diff(first, read()); diff != "" {
+		t.Fatalf("unexpected cached stats (-want +got):\n%s", diff)
+	}
+
+	now = now.Add(time.Second)
+	if diff := cmp.Diff(3.0, read()["user_cpu_seconds"]); diff != "" {
+		t.Fatalf("unexpected refreshed user CPU time (-want +got):\n%s", diff)
+	}
+
+	now = now.Add(5 * time.Second)
+	want := map[string]any{"error": "netlink failure"}
+	if diff := cmp.Diff(want, read()); diff != "" {
+		t.Fatalf("unexpected error object (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff(3, calls); diff != "" {
+		t.Fatalf("unexpected number of queries (-want +got):\n%s", diff)
+	}
+}
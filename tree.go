@@ -0,0 +1,125 @@
+package taskstats
+
+import (
+	"errors"
+	"os"
+	"sort"
+)
+
+// A ProcessTree is a process and all of its descendants, each with its own
+// statistics.
+type ProcessTree struct {
+	// TGID identifies the process.
+	TGID int
+
+	// Stats contains the statistics for this process alone. For running
+	// processes these are retrieved by a TGID query, and for exited processes
+	// they are taken from the process's exit notification.
+	Stats *Stats
+
+	// Exited reports whether the process had already exited when the tree
+	// was built.
+	Exited bool
+
+	// Children contains the child processes of this process, ordered by TGID.
+	Children []*ProcessTree
+}
+
+// Total returns the combined resource usage of the process and all of its
+// descendants. The identifiers and ElapsedTime of the result are those of the
+// root process.
+func (t *ProcessTree) Total() *Stats {
+	total := *t.Stats
+	for _, c := range t.Children {
+		total.add(c.Total())
+	}
+
+	return &total
+}
+
+// ProcessTree builds a ProcessTree rooted at the process identified by tgid.
+//
+// Running descendants are discovered using procfs and queried using
+// Process. A single query cannot account for descendants which have already
+// exited, so exits should contain the exit notifications received for the
+// tree, such as those gathered from an ExitListener which was started before
+// the root process. Exits for unrelated processes are ignored.
+//
+// Running processes whose parent exited are reparented by the kernel and can
+// no longer be attributed to the tree.
+func (c *Client) ProcessTree(tgid int, exits []Exit) (*ProcessTree, error) {
+	parents, err := procParents()
+	if err != nil {
+		return nil, err
+	}
+
+	return buildTree(tgid, parents, exits, c.Process)
+}
+
+// buildTree builds a ProcessTree rooted at root from the parents of running
+// processes and the exits of reaped ones, querying running processes using
+// query.
+func buildTree(root int, parents map[int]int, exits []Exit, query func(tgid int) (*Stats, error)) (*ProcessTree, error) {
+	// Exited processes take precedence over running ones, as their PIDs may
+	// since have been reused by unrelated processes.
+	var x exitSet
+	for _, e := range exits {
+		x.add(e)
+	}
+
+	exited := x.final
+	children := make(map[int][]int)
+	for tgid, stats := range exited {
+		children[stats.PPID] = append(children[stats.PPID], tgid)
+	}
+
+	for pid, ppid := range parents {
+		if _, ok := exited[pid]; ok {
+			continue
+		}
+
+		children[ppid] = append(children[ppid], pid)
+	}
+
+	var build func(tgid int) (*ProcessTree, error)
+	build = func(tgid int) (*ProcessTree, error) {
+		t := &ProcessTree{TGID: tgid}
+
+		if stats, ok := exited[tgid]; ok {
+			t.Stats, t.Exited = stats, true
+		} else {
+			stats, err := query(tgid)
+			if err != nil {
+				return nil, err
+			}
+			t.Stats = stats
+		}
+
+		kids := children[tgid]
+		sort.Ints(kids)
+
+		for _, k := range kids {
+			if k == tgid {
+				// Avoid looping on PID 0, which the kernel reports as its own
+				// parent.
+				continue
+			}
+
+			c, err := build(k)
+			if err != nil {
+				if errors.Is(err, os.ErrNotExist) {
+					// Exited since its parent was discovered.
+					continue
+				}
+
+				return nil, err
+			}
+
+			t.Children = append(t.Children, c)
+		}
+
+		return t, nil
+	}
+
+	return build(root)
+}
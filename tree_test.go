@@ -0,0 +1,151 @@
+package taskstats
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestBuildTree(t *testing.T) {
+	// 1
+	// ├── 2 (running)
+	// │   ├── 4 (exited, multithreaded)
+	// │   └── 5 (exited between discovery and query)
+	// └── 3 (exited)
+	//     └── 6 (thread exit, ignored)
+	parents := map[int]int{
+		1: 0,
+		2: 1,
+		5: 2,
+		7: 0,
+	}
+
+	exits := []Exit{
+		{
+			PID:   3,
+			Stats: &Stats{PID: 3, PPID: 1, UserCPUTime: 3 * time.Second},
+		},
+		{
+			PID:   4,
+			Stats: &Stats{PID: 4, PPID: 2, TGID: 4, UserCPUTime: 3 * time.Second},
+		},
+		{
+			PID:       8,
+			Stats:     &Stats{PID: 8, PPID: 2, TGID: 4, Flags: AccountingGroupExited, UserCPUTime: time.Second},
+			TGID:      4,
+			TGIDStats: &Stats{CPUDelay: 4},
+		},
+		{
+			PID:   6,
+			Stats: &Stats{PID: 6, PPID: 3, TGID: 9, UserCPUTime: 6 * time.Second},
+		},
+	}
+
+	query := func(tgid int) (*Stats, error) {
+		switch tgid {
+		case 1, 2:
+			return &Stats{
+				UserCPUTime: time.Duration(tgid) * time.Second,
+				CPUDelay:    time.Duration(tgid),
+			}, nil
+		default:
+			return nil, os.ErrNotExist
+		}
+	}
+
+	tree, err := buildTree(1, parents, exits, query)
+	if err != nil {
+		t.Fatalf("failed to build tree: %v", err)
+	}
+
+	want := &ProcessTree{
+		TGID:  1,
+		Stats: &Stats{UserCPUTime: time.Second, CPUDelay: 1},
+		Children: []*ProcessTree{
+			{
+				TGID:  2,
+				Stats: &Stats{UserCPUTime: 2 * time.Second, CPUDelay: 2},
+				Children: []*ProcessTree{{
+					TGID: 4,
+					Stats: &Stats{
+						PID:         4,
+						PPID:        2,
+						TGID:        4,
+						Flags:       AccountingGroupExited,
+						UserCPUTime: 4 * time.Second,
+						CPUDelay:    4,
+					},
+					Exited: true,
+				}},
+			},
+			{
+				TGID:   3,
+				Stats:  &Stats{PID: 3, PPID: 1, UserCPUTime: 3 * time.Second},
+				Exited: true,
+			},
+		},
+	}
+
+	if diff := cmp.Diff(want, tree); diff != "" {
+		t.Fatalf("unexpected process tree (-want +got):\n%s", diff)
+	}
+
+	total := &Stats{UserCPUTime: 10 * time.Second, CPUDelay: 7}
+	if diff := cmp.Diff(total, tree.Total()); diff != "" {
+		t.Fatalf("unexpected total stats (-want +got):\n%s", diff)
+	}
+}
+
+func TestBuildTreeRootNotExist(t *testing.T) {
+	query := func(_ int) (*Stats, error) {
+		return nil, os.ErrNotExist
+	}
+
+	_, err := buildTree(1, map[int]int{1: 0}, nil, query)
+	if !os.IsNotExist(err) {
+		t.Fatalf("expected is not exist, but got: %v", err)
+	}
+}
+
+func TestBuildTreeLeaderExitsFirst(t *testing.T) {
+	// Kernels which do not report TGIDs report a thread group leader which
+	// exits before its threads as a whole process, followed by the thread
+	// group statistics from the last thread.
+	exits := []Exit{
+		{
+			PID:   2,
+			Stats: &Stats{PID: 2, PPID: 1, CPUDelayCount: 97},
+		},
+		{
+			PID:       3,
+			Stats:     &Stats{PID: 3, PPID: 1},
+			TGID:      2,
+			TGIDStats: &Stats{CPUDelayCount: 193},
+		},
+	}
+
+	query := func(tgid int) (*Stats, error) {
+		return &Stats{PID: tgid}, nil
+	}
+
+	tree, err := buildTree(1, map[int]int{1: 0}, exits, query)
+	if err != nil {
+		t.Fatalf("failed to build tree: %v", err)
+	}
+
+	want := &ProcessTree{
+		TGID:  1,
+		Stats: &Stats{PID: 1},
+		Children: []*ProcessTree{{
+			TGID:   2,
+			Stats:  &Stats{PID: 2, PPID: 1, TGID: 2, CPUDelayCount: 193},
+			Exited: true,
+		}},
+	}
+
+	if diff := cmp.Diff(want, tree); diff != "" {
+		t.Fatalf("unexpected process tree (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,218 @@
+package taskstats
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// watchInterval is how often a Watch polls the statistics of its process.
+const watchInterval = time.Second
+
+// A Watch follows a single running process until it exits, providing its
+// statistics on demand while it runs and its final statistics once it exits.
+//
+// The final statistics are captured from the kernel's exit notification for
+// the process. The process is also polled periodically, so if the
+// notification is lost, the most recent sample is still available.
+//
+// Watch requires elevated privileges.
+type Watch struct {
+	pid     int
+	query   func(tgid int) (*Stats, error)
+	l       *ExitListener
+	timeout time.Duration
+
+	mu   sync.Mutex
+	last *Stats
+
+	done  chan struct{}
+	once  sync.Once
+	final *Stats
+	err   error
+}
+
+// Watch creates a Watch which follows the running process identified by pid.
+// If the process is not running, an error compatible with os.IsNotExist is
+// returned.
+//
+// Each Watch uses its own ExitListener, so callers following many processes
+// may prefer a single ExitListener or a Session.
+func (c *Client) Watch(pid int) (*Watch, error) {
+	// Listen before the first query so the exit is not missed.
+	l, err := ListenExits(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	w, err := newWatch(pid, c.Process, l, watchInterval, exitTimeout)
+	if err != nil {
+		_ = l.Close()
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// newWatch creates a Watch for pid which retrieves statistics using query and
+// exit notifications using l. The process is polled every interval, and
+// timeout is how long to wait for an exit notification once the process is
+// gone.
+func newWatch(pid int, query func(tgid int) (*Stats, error), l *ExitListener, interval, timeout time.Duration) (*Watch, error) {
+	last, err := query(pid)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Watch{
+		pid:     pid,
+		query:   query,
+		l:       l,
+		timeout: timeout,
+		last:    last,
+		done:    make(chan struct{}),
+	}
+
+	go w.run(interval)
+
+	return w, nil
+}
+
+// Stats returns the current statistics of the process. If the process has
+// exited, Stats waits for and returns its final statistics, as Wait does.
+func (w *Watch) Stats() (*Stats, error) {
+	select {
+	case <-w.done:
+		return w.Wait()
+	default:
+	}
+
+	stats, err := w.poll()
+	if errors.Is(err, os.ErrNotExist) {
+		return w.Wait()
+	}
+
+	return stats, err
+}
+
+// Done returns a channel which is closed when the final statistics of the
+// process are available from Wait.
+func (w *Watch) Done() <-chan struct{} {
+	return w.done
+}
+
+// Wait waits for the process to exit and returns its final statistics.
+//
+// If no exit notification was received for the process, Wait returns the
+// most recent sample of its statistics, which lacks any usage after that
+// sample was taken, along with an error. If the Watch is closed before the
+// process exits, Wait returns an error.
+func (w *Watch) Wait() (*Stats, error) {
+	<-w.done
+	return w.final, w.err
+}
+
+// Close releases resources used by a Watch. Close causes any pending call to
+// Wait to return an error if the process has not yet exited.
+func (w *Watch) Close() error {
+	return w.l.Close()
+}
+
+// poll retrieves the current statistics of the process, retaining them as the
+// most recent sample.
+func (w *Watch) poll() (*Stats, error) {
+	stats, err := w.query(w.pid)
+	if err != nil {
+		return nil, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.last = stats
+
+	return stats, nil
+}
+
+// run polls the process and waits for its exit notification until the final
+// statistics are known.
+func (w *Watch) run(interval time.Duration) {
+	defer w.l.Close()
+
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	var (
+		timeout <-chan time.Time
+		exits   exitSet
+	)
+
+	for {
+		select {
+		case e, ok := <-w.l.Exits():
+			if !ok {
+				err := w.l.Err()
+				if err == nil {
+					err = errors.New("taskstats: watch closed before process exited")
+				}
+
+				w.finish(nil, err)
+				return
+			}
+
+			if e.PID != w.pid && e.Stats.TGID != w.pid && e.TGID != w.pid {
+				continue
+			}
+
+			if tgid, _, ok := exits.add(e); !ok || tgid != w.pid {
+				continue
+			}
+
+			if exits.whole[w.pid] {
+				w.finish(exits.final[w.pid], nil)
+				return
+			}
+
+			// On kernels which do not report TGIDs, the exit may be that of a
+			// thread group leader whose process is still running. Its
+			// replacement is sent before the process disappears, so wait
+			// until then.
+		case <-tick.C:
+			if timeout != nil {
+				continue
+			}
+
+			_, err := w.poll()
+			switch {
+			case errors.Is(err, os.ErrNotExist) && exits.final[w.pid] != nil:
+				w.finish(exits.final[w.pid], nil)
+				return
+			case errors.Is(err, os.ErrNotExist):
+				// The kernel sends the exit notification before the process
+				// disappears, so it should arrive promptly unless it was
+				// dropped.
+				timeout = time.After(w.timeout)
+			case err != nil:
+				w.finish(nil, err)
+				return
+			}
+		case <-timeout:
+			w.mu.Lock()
+			last := w.last
+			w.mu.Unlock()
+
+			w.finish(last, fmt.Errorf("taskstats: no exit notification received for PID %d (%d overruns), using last sample",
+				w.pid, w.l.Overruns()))
+			return
+		}
+	}
+}
+
+// finish records the final statistics of the process.
+func (w *Watch) finish(stats *Stats, err error) {
+	w.once.Do(func() {
+		w.final, w.err = stats, err
+		close(w.done)
+	})
+}
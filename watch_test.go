@@ -0,0 +1,224 @@
+package taskstats
+
+import (
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWatchExit(t *testing.T) {
+	l := newTestListener()
+	query := func(tgid int) (*Stats, error) {
+		return &Stats{PID: tgid, TGID: tgid, UserCPUTime: time.Second}, nil
+	}
+
+	w, err := newWatch(10, query, &ExitListener{l: l}, time.Hour, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to watch: %v", err)
+	}
+	defer w.Close()
+
+	got, err := w.Stats()
+	if err != nil {
+		t.Fatalf("failed to get live stats: %v", err)
+	}
+
+	want := &Stats{PID: 10, TGID: 10, UserCPUTime: time.Second}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected live stats (-want +got):\n%s", diff)
+	}
+
+	// An unrelated exit and a thread exit, followed by the process itself.
+	l.exitC <- Exit{PID: 20, Stats: &Stats{PID: 20}}
+	l.exitC <- Exit{PID: 11, Stats: &Stats{PID: 11, TGID: 10}}
+	l.exitC <- Exit{PID: 10, Stats: &Stats{PID: 10, TGID: 10, Flags: AccountingGroupExited, UserCPUTime: 2 * time.Second}}
+
+	<-w.Done()
+
+	got, err = w.Wait()
+	if err != nil {
+		t.Fatalf("failed to wait: %v", err)
+	}
+
+	want = &Stats{PID: 10, TGID: 10, Flags: AccountingGroupExited, UserCPUTime: 2 * time.Second}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected final stats (-want +got):\n%s", diff)
+	}
+}
+
+func TestWatchMissedExit(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		running = true
+	)
+
+	query := func(tgid int) (*Stats, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if !running {
+			return nil, os.ErrNotExist
+		}
+
+		return &Stats{PID: tgid, UserCPUTime: time.Second}, nil
+	}
+
+	w, err := newWatch(10, query, &ExitListener{l: newTestListener()}, time.Millisecond, time.Millisecond)
+	if err != nil {
+		t.Fatalf("failed to watch: %v", err)
+	}
+	defer w.Close()
+
+	// The process exits and its notification is never delivered.
+	mu.Lock()
+	running = false
+	mu.Unlock()
+
+	got, err := w.Wait()
+	if err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+
+	want := &Stats{PID: 10, UserCPUTime: time.Second}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Fatalf("unexpected final stats (-want +got):\n%s", diff)
+	}
+}
+
+func TestWatchClosed(t *testing.T) {
+	query := func(tgid int) (*Stats, error) {
+		return &Stats{PID: tgid}, nil
+	}
+
+	w, err := newWatch(10, query, &ExitListener{l: newTestListener()}, time.Hour, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to watch: %v", err)
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	if _, err := w.Wait(); err == nil {
+		t.Fatal("expected an error, but none occurred")
+	}
+}
+
+func TestWatchNotExist(t *testing.T) {
+	query := func(_ int) (*Stats, error) {
+		return nil, os.ErrNotExist
+	}
+
+	_, err := newWatch(10, query, &ExitListener{l: newTestListener()}, time.Hour, time.Hour)
+	if !os.IsNotExist(err) {
+		t.Fatalf("expected is not exist, but got: %v", err)
+	}
+}
+
+var _ osListener = &testListener{}
+
+// A testListener is an osListener which delivers exits sent on exitC.
+type testListener struct {
+	exitC chan Exit
+	once  sync.Once
+}
+
+func newTestListener() *testListener {
+	return &testListener{exitC: make(chan Exit)}
+}
+
+func (l *testListener) Exits() <-chan Exit { return l.exitC }
+func (l *testListener) Err() error         { return nil }
+func (l *testListener) Overruns() uint64   { return 0 }
+
+func (l *testListener) Close() error {
+	l.once.Do(func() { close(l.exitC) })
+	return nil
+}
+
+func TestWatchLeaderExitsFirst(t *testing.T) {
+	tests := []struct {
+		name  string
+		exits []Exit
+	}{
+		{
+			name: "TGIDs",
+			exits: []Exit{
+				// The leader's exit lacks the flag marking the last task.
+				{PID: 10, Stats: &Stats{PID: 10, TGID: 10, CPUDelayCount: 97}},
+				{
+					PID:       11,
+					Stats:     &Stats{PID: 11, TGID: 10, Flags: AccountingGroupExited},
+					TGID:      10,
+					TGIDStats: &Stats{CPUDelayCount: 193},
+				},
+			},
+		},
+		{
+			name: "no TGIDs",
+			exits: []Exit{
+				{PID: 10, Stats: &Stats{PID: 10, CPUDelayCount: 97}},
+				{
+					PID:       11,
+					Stats:     &Stats{PID: 11, Flags: AccountingGroupExited},
+					TGID:      10,
+					TGIDStats: &Stats{CPUDelayCount: 193},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				mu      sync.Mutex
+				running = true
+			)
+
+			query := func(tgid int) (*Stats, error) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				if !running {
+					return nil, os.ErrNotExist
+				}
+
+				return &Stats{PID: tgid}, nil
+			}
+
+			l := newTestListener()
+			w, err := newWatch(10, query, &ExitListener{l: l}, time.Millisecond, time.Hour)
+			if err != nil {
+				t.Fatalf("failed to watch: %v", err)
+			}
+			defer w.Close()
+
+			l.exitC <- tt.exits[0]
+
+			select {
+			case <-w.Done():
+				t.Fatal("watch done after the leader exited alone")
+			case <-time.After(20 * time.Millisecond):
+			}
+
+			l.exitC <- tt.exits[1]
+
+			mu.Lock()
+			running = false
+			mu.Unlock()
+
+			got, err := w.Wait()
+			if err != nil {
+				t.Fatalf("failed to wait: %v", err)
+			}
+
+			want := &Stats{PID: 10, TGID: 10, Flags: AccountingGroupExited, CPUDelayCount: 193}
+			if diff := cmp.Diff(want, got); diff != "" {
+				t.Fatalf("unexpected final stats (-want +got):\n%s", diff)
+			}
+		})
+	}
+}